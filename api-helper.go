@@ -2,7 +2,6 @@ package apiclient
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 )
 
 // //Get - make HTTP GET request to given url and return RawResult{}.
@@ -34,9 +34,13 @@ func (a *API) SetLogWriter(w io.Writer) {
 	a.logger = l
 }
 
-// Get - make HTTP GET request to given api path and return RawResult{}.
+// Get - make HTTP GET request to given api path and return RawResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (a *API) Get(apipath string) (APIResult, error) {
-	return a.GetURL(a.GetBaseURL() + apipath)
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.GetURL(apiurl)
 }
 
 // GetURL - make HTTP GET request to given url and return RawResult{}.
@@ -47,12 +51,7 @@ func (a *API) GetURL(apiurl string) (APIResult, error) {
 		return res, err
 	}
 	a.injectHeaders(r)
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -63,9 +62,13 @@ func (a *API) GetURL(apiurl string) (APIResult, error) {
 	return getRawResult(resp), nil
 }
 
-// Post - make HTTP POST request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Post - make HTTP POST request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (a *API) Post(apipath string, postdataJSON []byte) (APIResult, error) {
-	return a.PostURL(a.GetBaseURL()+apipath, postdataJSON)
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.PostURL(apiurl, postdataJSON)
 }
 
 // PostURL - make HTTP POST request to given url and post JSON data and return RawResult{}.
@@ -81,13 +84,8 @@ func (a *API) PostURL(apiurl string, postdataJSON []byte) (APIResult, error) {
 		return res, err
 	}
 	a.injectHeaders(r)
-	r.Header.Set("Content-Type", "application/json")
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	setDefaultContentType(r, "application/json")
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -112,13 +110,8 @@ func (a *API) PostForm(apiurl string, data map[string]string) (APIResult, error)
 		return res, err
 	}
 	a.injectHeaders(r)
-	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	setDefaultContentType(r, "application/x-www-form-urlencoded")
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -129,9 +122,13 @@ func (a *API) PostForm(apiurl string, data map[string]string) (APIResult, error)
 	return getRawResult(resp), nil
 }
 
-// Put - make HTTP PUT request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Put - make HTTP PUT request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (a *API) Put(apipath string, putdataJSON []byte) (APIResult, error) {
-	return a.PutURL(a.GetBaseURL()+apipath, putdataJSON)
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.PutURL(apiurl, putdataJSON)
 }
 
 // PutURL - make HTTP PUT request to given url and post JSON data and return RawResult{}.
@@ -147,13 +144,8 @@ func (a *API) PutURL(apiurl string, putdataJSON []byte) (APIResult, error) {
 		return res, err
 	}
 	a.injectHeaders(r)
-	r.Header.Set("Content-Type", "application/json")
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	setDefaultContentType(r, "application/json")
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -164,9 +156,13 @@ func (a *API) PutURL(apiurl string, putdataJSON []byte) (APIResult, error) {
 	return getRawResult(resp), nil
 }
 
-// Patch - make HTTP PATCH request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Patch - make HTTP PATCH request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (a *API) Patch(apipath string, putdataJSON []byte) (APIResult, error) {
-	return a.PatchURL(a.GetBaseURL()+apipath, putdataJSON)
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.PatchURL(apiurl, putdataJSON)
 }
 
 // PatchURL - make HTTP PATCH request to given url and post JSON data and return RawResult{}.
@@ -182,13 +178,8 @@ func (a *API) PatchURL(apiurl string, patchdataJSON []byte) (APIResult, error) {
 		return res, err
 	}
 	a.injectHeaders(r)
-	r.Header.Set("Content-Type", "application/json")
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	setDefaultContentType(r, "application/json")
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -199,9 +190,13 @@ func (a *API) PatchURL(apiurl string, patchdataJSON []byte) (APIResult, error) {
 	return getRawResult(resp), nil
 }
 
-// Delete - make HTTP DELETE request to given api path and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Delete - make HTTP DELETE request to given api path and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (a *API) Delete(apipath string) (APIResult, error) {
-	return a.DeleteURL(a.GetBaseURL() + apipath)
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.DeleteURL(apiurl)
 }
 
 // DeleteURL - make HTTP DELETE request to given url and return RawResult{}.
@@ -212,12 +207,7 @@ func (a *API) DeleteURL(apiurl string) (APIResult, error) {
 		return res, err
 	}
 	a.injectHeaders(r)
-	if a.UseBasicAuth {
-		r.SetBasicAuth(a.BasicAuthUser, a.BasicAuthPwd)
-	}
-
-	client := a.getClient()
-	resp, err := client.Do(r)
+	resp, err := a.do(r)
 	if err != nil {
 		return res, err
 	}
@@ -228,6 +218,80 @@ func (a *API) DeleteURL(apiurl string) (APIResult, error) {
 	return getRawResult(resp), nil
 }
 
+// do set basic-auth credentials to r and send it, retrying when connection to server fails
+func (a *API) do(r *http.Request) (*http.Response, error) {
+	if err := a.setBasicAuth(r); err != nil {
+		closeBody(r)
+		return nil, err
+	}
+
+	a.Compression.prepare(r)
+
+	client := a.getClient()
+	for retry := 0; ; retry++ {
+		resp, err := client.Do(r)
+		if err == nil {
+			a.Compression.decompress(resp)
+		}
+		if err == nil || !connectFailed(err) || retry >= retries(a.MaxRetry) {
+			return resp, err
+		}
+		if r.Body != nil {
+			if r.GetBody == nil {
+				return nil, fmt.Errorf("%w (body not replayable)", err)
+			}
+			if r.Body, err = r.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		a.logMsg("do", "Api-Error: %v, retrying", err)
+		time.Sleep(retryWait(a.RetryWait))
+	}
+}
+
+// setBasicAuth set basic-auth credentials to r when UseBasicAuth or UseNetrc is enabled,
+// or credentials of Auth set by WithAuth
+func (a *API) setBasicAuth(r *http.Request) error {
+	if a.auth != nil {
+		return a.auth.Apply(r)
+	}
+	if !a.UseBasicAuth {
+		if a.UseNetrc {
+			return a.setNetrcAuth(r)
+		}
+		return nil
+	}
+	pwd := a.BasicAuthPwd
+	if a.BasicAuthPwdProvider != nil {
+		var err error
+		pwd, err = a.BasicAuthPwdProvider.Secret(r.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get basic-auth password: %v", err)
+		}
+	}
+	r.SetBasicAuth(a.BasicAuthUser, pwd)
+	return nil
+}
+
+// joinURL returns URL for apipath under ResourceAPIBaseURL. Absolute apipath on other host is
+// rejected when a sends credentials, except host-scoped ones from .netrc.
+func (a *API) joinURL(apipath string) (string, error) {
+	if a.UseBasicAuth || a.auth != nil || hasAuthHeader(a.headers) {
+		return joinAuthURL(a.GetBaseURL(), apipath)
+	}
+	return JoinURL(a.GetBaseURL(), apipath)
+}
+
+// hasAuthHeader tells if headers set Authorization
+func hasAuthHeader(headers map[string]string) bool {
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == "Authorization" {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *API) injectHeaders(r *http.Request) {
 	if len(a.headers) > 0 {
 		for k, v := range a.headers {
@@ -253,7 +317,7 @@ func getRawResult(resp *http.Response) APIResult {
 func getAPIResult(resp *http.Response) (APIResult, error) {
 	defer resp.Body.Close()
 	res := APIResult{}
-	json.NewDecoder(resp.Body).Decode(&res)
+	apiResultCodec(resp).Decode(resp.Body, &res)
 	res.ErrValid = true
 	return res, nil
 }
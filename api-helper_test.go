@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"testing"
@@ -74,8 +75,12 @@ func TestAPIGet(t *testing.T) {
 }
 
 func TestAPIGetBasicAuth(t *testing.T) {
+	user := os.Getenv("RAZORPAY_KEY_ID")
+	if user == "" {
+		t.Skip("RAZORPAY_KEY_ID and RAZORPAY_KEY_SECRET not set")
+	}
 	url := "/orders/order_FgP6jhvCOWM1Hk/payments"
-	api := API{AllowInsecureSSL: true, StructuredResponse: false, UseBasicAuth: true, BasicAuthUser: "rzp_test_ZlzD0ybRfBYmC5", BasicAuthPwd: "vicl3kdxVRmMaMj1w4qmsFNL"}
+	api := API{AllowInsecureSSL: true, StructuredResponse: false, UseBasicAuth: true, BasicAuthUser: user, BasicAuthPwdProvider: EnvSecret("RAZORPAY_KEY_SECRET")}
 	api.ResourceAPIBaseURL = "https://api.razorpay.com/v1"
 	res, err := api.Get(url)
 	if err != nil {
@@ -1,6 +1,7 @@
 package apiclient
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
@@ -32,6 +33,32 @@ type API struct {
 	BasicAuthPwd       string
 	UseBasicAuth       bool
 	headers            map[string]string
+
+	// BasicAuthPwdProvider, if set, supply basic-auth password at request time in place of BasicAuthPwd
+	BasicAuthPwdProvider SecretProvider `json:"-"`
+
+	// UseNetrc, if set and UseBasicAuth is not, send basic-auth credentials found in .netrc for host of request
+	UseNetrc bool
+	// NetrcPath is .netrc file used by UseNetrc, default is NETRC environment variable or ~/.netrc
+	NetrcPath string
+
+	// MaxRetry is how many times a request failing to connect is retried, default 2. Negative disable retries.
+	MaxRetry int
+	// RetryWait is delay before retrying a request, default 500ms
+	RetryWait time.Duration
+	// TLSConfig, if set, is used for HTTPS connections, AllowInsecureSSL still apply
+	TLSConfig *tls.Config `json:"-"`
+	// Transport, if set, is used in place of transport built from AllowInsecureSSL and TLSConfig
+	Transport http.RoundTripper `json:"-"`
+	// Compression, if set, compress request bodies and decompress responses
+	Compression *Compression `json:"-"`
+	// Codecs decode responses of Request by their Content-Type, before built-in codecs
+	Codecs []Codec `json:"-"`
+
+	// client is built once by NewAPI and shared by all requests
+	client *http.Client
+	// auth, set by WithAuth, replace basic-auth settings
+	auth Auth
 }
 
 // //SAPI - allow to make calls to Structured APIs using GET, POST, PUT, DELETE methods which itself return response as APIReuslt{}
@@ -53,12 +80,17 @@ func (j API) GetTimeout() time.Duration {
 	return j.Timeout
 }
 func (j API) getClient() *http.Client {
-	return getClient(j.InsecureSSLEnabled(), j.GetTimeout())
+	if j.client != nil {
+		return j.client
+	}
+	return getClient(j.InsecureSSLEnabled(), j.GetTimeout(), j.TLSConfig, j.Transport)
 }
 func (j API) GetBaseURL() string {
 	return j.ResourceAPIBaseURL
 }
 
+// SetHeaders set headers sent with every request. It is not safe while requests are running,
+// use WithHeader to get a client with its own headers.
 func (j *API) SetHeaders(h map[string]string) {
 	j.headers = h
 }
@@ -69,18 +101,18 @@ func (j *API) ClearHeaders() {
 func (j API) logMsg(methodname, format string, msg ...interface{}) {
 	if j.logger == nil {
 		return
-		j.logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 	j.logger.Printf("INFO: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
 }
 func (j API) logDebug(methodname, format string, msg ...interface{}) {
-	if j.logger == nil {
-		j.logger = log.New(os.Stdout, "", log.LstdFlags)
-	}
 	if !j.DebugEnabled() {
 		return
 	}
-	j.logger.Printf("DEBUG: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
+	l := j.logger
+	if l == nil {
+		l = log.New(os.Stdout, "", log.LstdFlags)
+	}
+	l.Printf("DEBUG: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
 }
 
 // func (j SAPI) InsecureSSLEnabled() bool {
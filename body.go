@@ -0,0 +1,187 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// errBodyNotReplayable is returned when a request has to be sent again but its body was already read
+var errBodyNotReplayable = errors.New("request body can't be sent again, use a replayable body to allow retries")
+
+// requestBody is body of request, opened again for each attempt when it is replayable
+type requestBody struct {
+	open func() (io.ReadCloser, error)
+	// size is length of body, -1 if unknown
+	size   int64
+	replay bool
+}
+
+// newRequestBody returns requestBody reading from r. Body is replayable, with known size, when r is
+// *bytes.Buffer or implements both io.ReaderAt and io.Seeker, like *os.File, *bytes.Reader and *strings.Reader.
+// Other readers are streamed once with unknown size.
+func newRequestBody(r io.Reader) (requestBody, error) {
+	switch v := r.(type) {
+	case nil:
+		return bodyFromBytes(nil), nil
+	case *bytes.Buffer:
+		return bodyFromBytes(v.Bytes()), nil
+	}
+
+	if ra, ok := r.(io.ReaderAt); ok {
+		if s, ok := r.(io.Seeker); ok {
+			offset, err := s.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return requestBody{}, fmt.Errorf("failed to get size of body: %v", err)
+			}
+			end, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return requestBody{}, fmt.Errorf("failed to get size of body: %v", err)
+			}
+			if _, err := s.Seek(offset, io.SeekStart); err != nil {
+				return requestBody{}, fmt.Errorf("failed to get size of body: %v", err)
+			}
+			// each attempt read through its own section, as previous attempt may still be closing
+			open := func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(io.NewSectionReader(ra, offset, end-offset)), nil
+			}
+			return requestBody{open: open, size: end - offset, replay: true}, nil
+		}
+	}
+
+	opened := false
+	open := func() (io.ReadCloser, error) {
+		if opened {
+			return nil, errBodyNotReplayable
+		}
+		opened = true
+		if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return ioutil.NopCloser(r), nil
+	}
+	return requestBody{open: open, size: -1}, nil
+}
+
+func bodyFromBytes(b []byte) requestBody {
+	open := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return requestBody{open: open, size: int64(len(b)), replay: true}
+}
+
+// newRequest returns request with body b opened for first attempt
+func (b requestBody) newRequest(ctx context.Context, method, apiurl string) (*http.Request, error) {
+	if b.size == 0 {
+		return http.NewRequestWithContext(ctx, method, apiurl, http.NoBody)
+	}
+	body, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, method, apiurl, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	r.ContentLength = b.size
+	if b.size < 0 {
+		r.ContentLength = 0
+	}
+	r.GetBody = nil
+	if b.replay {
+		r.GetBody = b.open
+	}
+	return r, nil
+}
+
+// closeBody close body of request which is not sent, so goroutine or file feeding it is released
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
+
+// DoReader - make HTTP request with given method to apiurl, sending body read from body with given content-type.
+// Body is streamed without being read in memory, see DoBody for retries.
+func (a *API) DoReader(ctx context.Context, method, apiurl, contentType string, body io.Reader) (APIResult, error) {
+	b, err := newRequestBody(body)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return a.doBody(ctx, method, apiurl, contentType, b)
+}
+
+// DoBody - make HTTP request with given method to apiurl, sending body returned by body with given content-type.
+// body is called again when request is retried. size is length of body, -1 if unknown.
+//
+// Requests with io.Reader bodies can be retried only when reader is *bytes.Buffer or implements
+// io.ReaderAt and io.Seeker (like *os.File), other readers give error when retry is needed.
+func (a *API) DoBody(ctx context.Context, method, apiurl, contentType string, body func() (io.ReadCloser, error), size int64) (APIResult, error) {
+	return a.doBody(ctx, method, apiurl, contentType, requestBody{open: body, size: size, replay: true})
+}
+
+func (a *API) doBody(ctx context.Context, method, apiurl, contentType string, body requestBody) (APIResult, error) {
+	var res APIResult
+	r, err := body.newRequest(ctx, method, apiurl)
+	if err != nil {
+		return res, err
+	}
+	a.injectHeaders(r)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := a.do(r)
+	if err != nil {
+		return res, err
+	}
+
+	if a.StructuredResponse {
+		return getAPIResult(resp)
+	}
+	return getRawResult(resp), nil
+}
+
+// DoReader - call given apiurl with given method, sending body read from body with given content-type
+// (default application/json), auto inject Authorization Header. Body is streamed without being read in memory.
+// Request can be retried, e.g. after token is renewed on 401, only when reader is *bytes.Buffer or
+// implements io.ReaderAt and io.Seeker (like *os.File), else error is returned when retry is needed.
+func (j *JwtAPI) DoReader(ctx context.Context, method, apiurl, contentType string, body io.Reader) (APIResult, error) {
+	b, err := newRequestBody(body)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.doBody(ctx, method, apiurl, contentType, b)
+}
+
+// DoBody - call given apiurl with given method, sending body returned by body with given content-type
+// (default application/json), auto inject Authorization Header. body is called again for each retry.
+// size is length of body, -1 if unknown.
+func (j *JwtAPI) DoBody(ctx context.Context, method, apiurl, contentType string, body func() (io.ReadCloser, error), size int64) (APIResult, error) {
+	return j.doBody(ctx, method, apiurl, contentType, requestBody{open: body, size: size, replay: true})
+}
+
+func (j *JwtAPI) doBody(ctx context.Context, method, apiurl, contentType string, body requestBody) (APIResult, error) {
+	var res APIResult
+	var header http.Header
+	if contentType != "" {
+		header = http.Header{"Content-Type": {contentType}}
+	}
+	resp, err := j.makeRequestBody(ctx, method, apiurl, body, header)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return res, err
+	}
+
+	if j.StructuredResponse {
+		return getAPIResultJWT(resp)
+	}
+	return getRawResultJWT(resp)
+}
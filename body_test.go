@@ -0,0 +1,172 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// onceReader is a reader which can't be replayed
+type onceReader struct {
+	r io.Reader
+}
+
+func (o *onceReader) Read(p []byte) (int, error) {
+	return o.r.Read(p)
+}
+
+func TestStreamingBody(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: fmt.Sprintf("stream-%d", n)})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if extractToken(r) == "stream-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "%d|%s|%s", r.ContentLength, r.Header.Get("Content-Type"), body)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString("header\nfile content")
+	f.Seek(7, io.SeekStart)
+
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		do   func(j *JwtAPI) (APIResult, error)
+		exp  string
+	}{
+		{"file", func(j *JwtAPI) (APIResult, error) {
+			return j.DoReader(ctx, http.MethodPut, srv.URL+"/upload", "text/plain", f)
+		}, "12|text/plain|file content"},
+		{"factory", func(j *JwtAPI) (APIResult, error) {
+			open := func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader("from factory")), nil }
+			return j.DoBody(ctx, http.MethodPost, srv.URL+"/upload", "", open, -1)
+		}, "-1|application/json|from factory"},
+		{"once", func(j *JwtAPI) (APIResult, error) {
+			return j.DoReader(ctx, http.MethodPost, srv.URL+"/upload", "", &onceReader{strings.NewReader("once")})
+		}, ""},
+	}
+	for _, tc := range tests {
+		atomic.StoreInt32(&logins, 0)
+		j, _ := NewJwtAPI(srv.URL, srv.URL+"/token")
+		res, err := tc.do(j)
+		if tc.exp == "" {
+			if err != errBodyNotReplayable {
+				t.Errorf("%s: Expected error for retry of non-replayable body,  Got: %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil || res.Data != tc.exp {
+			t.Errorf("%s: Expected: %s,  Got: %s (%v)", tc.name, tc.exp, res.Data, err)
+		}
+	}
+
+	a, _ := NewAPI(srv.URL)
+	res, err := a.DoReader(ctx, http.MethodPut, srv.URL+"/upload", "text/csv", &onceReader{strings.NewReader("a,b")})
+	if exp := "-1|text/csv|a,b"; err != nil || res.Data != exp {
+		t.Errorf("Expected: %s,  Got: %s (%v)", exp, res.Data, err)
+	}
+
+	// connection failure is returned when non-replayable body can't be sent again
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	a, _ = NewAPI(down.URL, WithRetry(1, time.Millisecond))
+	jd, _ := NewJwtAPI(down.URL, down.URL+"/token", WithRetry(1, time.Millisecond))
+	jd = jd.WithAuth(BearerAuth(StaticSecret("t")))
+	for name, do := range map[string]func() (APIResult, error){
+		"API": func() (APIResult, error) {
+			return a.DoReader(ctx, http.MethodPost, down.URL+"/upload", "", &onceReader{strings.NewReader("once")})
+		},
+		"JwtAPI": func() (APIResult, error) {
+			return jd.DoReader(ctx, http.MethodPost, down.URL+"/upload", "", &onceReader{strings.NewReader("once")})
+		},
+	} {
+		var op *net.OpError
+		if _, err := do(); !errors.As(err, &op) || !strings.Contains(err.Error(), "not replayable") {
+			t.Errorf("%s: Expected dial error for non-replayable body,  Got: %v", name, err)
+		}
+	}
+}
+
+// closeCounter count Close of bodies opened for requests
+type closeCounter struct {
+	io.Reader
+	closed *int32
+}
+
+func (c closeCounter) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return nil
+}
+
+type failingSecret struct{}
+
+func (failingSecret) Secret(ctx context.Context) (string, error) {
+	return "", fmt.Errorf("vault unavailable")
+}
+
+func TestBodyClosedOnAuthError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request sent to %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	a, _ := NewAPI(srv.URL, WithBasicAuthProvider("svc", failingSecret{}))
+	j, _ := NewJwtAPI(srv.URL, srv.URL+"/token")
+	j = j.WithAuth(AuthFunc(func(r *http.Request) error { return fmt.Errorf("no credentials") }))
+	ctx := context.Background()
+
+	var closed int32
+	body := func() (io.ReadCloser, error) {
+		return closeCounter{strings.NewReader("data"), &closed}, nil
+	}
+	if _, err := a.DoBody(ctx, http.MethodPost, srv.URL+"/upload", "text/plain", body, 4); err == nil {
+		t.Errorf("Expected error from secret provider")
+	}
+	if _, err := j.DoBody(ctx, http.MethodPost, srv.URL+"/upload", "text/plain", body, 4); err == nil {
+		t.Errorf("Expected error from auth")
+	}
+	if closed != 2 {
+		t.Errorf("Expected bodies closed after auth errors,  Got %d closed", closed)
+	}
+
+	// writer goroutines of multipart bodies end
+	before := runtime.NumGoroutine()
+	m := Multipart{Files: []FilePart{{FieldName: "f", FileName: "a.txt", Reader: strings.NewReader("content")}}}
+	for i := 0; i < 20; i++ {
+		a.PostMultipart(ctx, "/upload", m)
+		j.PostMultipart(ctx, "/upload", m)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("Expected multipart writers ended,  Got %d goroutines, %d before", n, before)
+	}
+}
@@ -0,0 +1,212 @@
+package apiclient
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Codec encode request bodies and decode response bodies of one media type
+type Codec interface {
+	// ContentType is sent as Content-Type of bodies encoded by codec, its media type
+	// is also matched with Content-Type of responses to pick codec for decoding them
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// Built-in codecs. JSONCodec also decode responses with media type having +json suffix, like
+// application/problem+json, and XMLCodec those with +xml suffix and text/xml.
+var (
+	JSONCodec Codec = jsonCodec{}
+	XMLCodec  Codec = xmlCodec{}
+	// FormCodec encode url.Values, map[string]string or struct with `url` tags (see SetQueryStruct)
+	// and decode into *url.Values or *map[string]string
+	FormCodec Codec = formCodec{}
+	// TextCodec encode string, []byte, fmt.Stringer or encoding.TextMarshaler and decode into
+	// *string, *[]byte or encoding.TextUnmarshaler
+	TextCodec Codec = textCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string { return "application/xml" }
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+type formCodec struct{}
+
+func (formCodec) ContentType() string { return "application/x-www-form-urlencoded" }
+
+func (formCodec) Encode(w io.Writer, v interface{}) error {
+	var form url.Values
+	switch f := v.(type) {
+	case url.Values:
+		form = f
+	case map[string][]string:
+		form = f
+	case map[string]string:
+		form = url.Values{}
+		for k, v := range f {
+			form.Set(k, v)
+		}
+	default:
+		var err error
+		if form, err = structValues(v); err != nil {
+			return fmt.Errorf("can't encode %T as form: %v", v, err)
+		}
+	}
+	_, err := io.WriteString(w, form.Encode())
+	return err
+}
+
+func (formCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch f := v.(type) {
+	case *url.Values:
+		*f = form
+	case *map[string][]string:
+		*f = form
+	case *map[string]string:
+		*f = make(map[string]string, len(form))
+		for k := range form {
+			(*f)[k] = form.Get(k)
+		}
+	default:
+		return fmt.Errorf("can't decode form into %T", v)
+	}
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (textCodec) Encode(w io.Writer, v interface{}) error {
+	var err error
+	switch t := v.(type) {
+	case string:
+		_, err = io.WriteString(w, t)
+	case []byte:
+		_, err = w.Write(t)
+	case encoding.TextMarshaler:
+		var b []byte
+		if b, err = t.MarshalText(); err == nil {
+			_, err = w.Write(b)
+		}
+	case fmt.Stringer:
+		_, err = io.WriteString(w, t.String())
+	default:
+		return fmt.Errorf("can't encode %T as text", v)
+	}
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case *string:
+		*t = string(data)
+	case *[]byte:
+		*t = data
+	case encoding.TextUnmarshaler:
+		return t.UnmarshalText(data)
+	default:
+		return fmt.Errorf("can't decode text into %T", v)
+	}
+	return nil
+}
+
+// isTextValue tells if TextCodec can decode into v
+func isTextValue(v interface{}) bool {
+	switch v.(type) {
+	case *string, *[]byte, encoding.TextUnmarshaler:
+		return true
+	}
+	return false
+}
+
+// codecFor returns codec for media type of contentType, looked up in custom codecs before
+// built-in ones. It returns nil when no codec match.
+func codecFor(contentType string, custom []Codec) Codec {
+	mt := mediaType(contentType)
+	if mt == "" {
+		return nil
+	}
+	for _, c := range custom {
+		if mediaType(c.ContentType()) == mt {
+			return c
+		}
+	}
+
+	switch {
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		return JSONCodec
+	case mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml"):
+		return XMLCodec
+	case mt == "application/x-www-form-urlencoded":
+		return FormCodec
+	case mt == "text/plain":
+		return TextCodec
+	}
+	return nil
+}
+
+// mediaType returns lower-case media type of contentType without parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// apiResultCodec returns codec decoding APIResult from resp, JSON unless response is XML
+func apiResultCodec(resp *http.Response) Codec {
+	if c := codecFor(resp.Header.Get("Content-Type"), nil); c == XMLCodec {
+		return c
+	}
+	return JSONCodec
+}
+
+// setDefaultContentType set Content-Type of r to contentType when it is not set by headers of client
+func setDefaultContentType(r *http.Request, contentType string) {
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+}
@@ -0,0 +1,160 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csvCodec is custom codec for text/csv rows of comma separated values
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+func (csvCodec) Encode(w io.Writer, v interface{}) error {
+	for _, row := range v.([][]string) {
+		if _, err := io.WriteString(w, strings.Join(row, ",")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (csvCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	rows := v.(*[][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		*rows = append(*rows, strings.Split(line, ","))
+	}
+	return nil
+}
+
+type order struct {
+	XMLName xml.Name `xml:"order" json:"-"`
+	ID      string   `xml:"id,attr"`
+	Item    string   `xml:"item"`
+	Qty     int      `xml:"qty"`
+}
+
+func TestCodecs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		ct := r.Header.Get("Content-Type")
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(Token{AccessToken: "c"})
+		case "/echo":
+			// send request body back with its content-type
+			w.Header().Set("Content-Type", ct)
+			w.Write(data)
+		case "/text":
+			w.Write([]byte("plain " + ct))
+		case "/result":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.Write([]byte(`<APIResult><HTTPStatus>200</HTTPStatus><Data>ok ` + ct + `</Data></APIResult>`))
+		case "/problem":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"title":"bad qty"}`))
+		}
+	}))
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token", WithCodecs(csvCodec{}))
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	ctx := context.Background()
+
+	var xmlOrder order
+	resp, err := j.R().SetXMLBody(order{ID: "7", Item: "pen", Qty: 2}).SetResult(&xmlOrder).Post(ctx, "/echo")
+	if err != nil {
+		t.Fatalf("XML Post error: %v", err)
+	}
+	if xmlOrder.ID != "7" || xmlOrder.Item != "pen" || xmlOrder.Qty != 2 || !strings.HasPrefix(resp.String(), "<order") {
+		t.Errorf("Expected XML order echoed,  Got: %+v from %s", xmlOrder, resp.Body)
+	}
+
+	var form map[string]string
+	if _, err := j.R().SetFormBody(url.Values{"q": {"a b"}}).SetResult(&form).Post(ctx, "/echo"); err != nil || form["q"] != "a b" {
+		t.Errorf("Expected form echoed,  Got: %v %v", form, err)
+	}
+
+	var rows [][]string
+	if _, err := j.R().SetCodecBody([][]string{{"id", "qty"}, {"7", "2"}}, csvCodec{}).SetResult(&rows).Post(ctx, "/echo"); err != nil || len(rows) != 2 || rows[1][1] != "2" {
+		t.Errorf("Expected CSV rows echoed by custom codec,  Got: %v %v", rows, err)
+	}
+
+	var text string
+	if _, err := j.R().SetResult(&text).Get(ctx, "/text"); err != nil || !strings.HasPrefix(text, "plain ") {
+		t.Errorf("Expected text result,  Got: %q %v", text, err)
+	}
+
+	// codec set by SetResponseCodec is used whatever the Content-Type of response
+	var m map[string]int
+	if _, err := j.R().SetBody(strings.NewReader(`{"qty":3}`), "application/xml").SetResponseCodec(JSONCodec).SetResult(&m).Post(ctx, "/echo"); err != nil || m["qty"] != 3 {
+		t.Errorf("Expected JSON decoded by response codec,  Got: %v %v", m, err)
+	}
+
+	var problem struct{ Title string }
+	resp, err = j.R().SetJSONBody(map[string]int{"qty": -1}).SetError(&problem).Post(ctx, "/problem")
+	if err != nil || !resp.IsError() || problem.Title != "bad qty" {
+		t.Errorf("Expected +json error decoded,  Got: %+v %v", problem, err)
+	}
+
+	// Content-Type set by SetHeaders is not replaced by JSON
+	a, _ := NewAPI(srv.URL, WithStructuredResponse())
+	a.SetHeaders(map[string]string{"Content-Type": "application/xml"})
+	res, err := a.Post("/result", []byte(`<order id="1"/>`))
+	if err != nil || res.HTTPStatus != 200 || res.Data != "ok application/xml" {
+		t.Errorf("Expected XML APIResult for XML post,  Got: %+v %v", res, err)
+	}
+	j.SetHeaders(map[string]string{"Content-Type": "application/xml"})
+	if res, err := j.Post("/text", []byte(`<order/>`)); err != nil || res.Data != "plain application/xml" {
+		t.Errorf("Expected XML content-type kept by JwtAPI,  Got: %+v %v", res, err)
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		contentType string
+		codec       Codec
+	}{
+		{"application/json; charset=utf-8", JSONCodec},
+		{"application/vnd.api+json", JSONCodec},
+		{"Application/XML", XMLCodec},
+		{"application/atom+xml", XMLCodec},
+		{"application/x-www-form-urlencoded", FormCodec},
+		{"text/plain", TextCodec},
+		{"text/csv; header=present", csvCodec{}},
+		{"application/octet-stream", nil},
+		{"", nil},
+	}
+	for _, tc := range tests {
+		if c := codecFor(tc.contentType, []Codec{csvCodec{}}); c != tc.codec {
+			t.Errorf("%q: Expected codec %T,  Got: %T", tc.contentType, tc.codec, c)
+		}
+	}
+
+	var buf strings.Builder
+	if err := FormCodec.Encode(&buf, struct {
+		Page int    `url:"page"`
+		Q    string `url:"q,omitempty"`
+	}{Page: 2}); err != nil || buf.String() != "page=2" {
+		t.Errorf("Expected struct encoded as form,  Got: %q %v", buf.String(), err)
+	}
+	var v json.Number
+	if err := TextCodec.Decode(strings.NewReader("1"), &v); err == nil {
+		t.Errorf("Expected error decoding text into %T", &v)
+	}
+}
@@ -3,6 +3,9 @@ package apiclient
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
 )
 
 // APIResult is structured response returned from APIs developed by samtech09
@@ -39,3 +42,79 @@ func jsonStringToStruct(jsonstring string, dest interface{}) error {
 	}
 	return nil
 }
+
+// JoinURL returns URL for apipath under base URL. apipath is resolved as a reference (RFC 3986)
+// relative to base, with base path treated as a directory:
+//
+//   - absolute apipath (with scheme and host) is returned as it is. Get, Post and other path methods of
+//     JwtAPI, and of API sending credentials, reject it unless it is on scheme and host of base URL.
+//   - leading slashes of apipath are ignored, so "/users" and "users" both resolve under base path,
+//     e.g. "https://host/api/v1" or "https://host/api/v1/" with "/users" give "https://host/api/v1/users"
+//   - "." and ".." segments of apipath are resolved, and can climb above base path
+//   - query of base is kept and query of apipath is added to it
+//   - empty apipath returns base itself
+func JoinURL(base, apipath string) (string, error) {
+	ref, err := url.Parse(apipath)
+	if err != nil {
+		return "", fmt.Errorf("invalid API path %q: %v", apipath, err)
+	}
+	if ref.IsAbs() && ref.Host != "" {
+		return apipath, nil
+	}
+	rel := strings.TrimLeft(apipath, "/")
+	if rel != "" && rel[0] != '?' && rel[0] != '#' {
+		// keep colon in first segment, like "users:search", from being read as scheme
+		rel = "./" + rel
+	}
+	if ref, err = url.Parse(rel); err != nil {
+		return "", fmt.Errorf("invalid API path %q: %v", apipath, err)
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %v", base, err)
+	}
+	if !b.IsAbs() || b.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: URL must be absolute", base)
+	}
+
+	dir := *b
+	dir.RawQuery = ""
+	dir.Fragment = ""
+	if ref.Path != "" && !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+		if dir.RawPath != "" {
+			dir.RawPath += "/"
+		}
+	}
+	u := dir.ResolveReference(ref)
+
+	switch {
+	case ref.RawQuery == "":
+		u.RawQuery = b.RawQuery
+	case b.RawQuery != "":
+		u.RawQuery = b.RawQuery + "&" + ref.RawQuery
+	}
+	return u.String(), nil
+}
+
+// joinAuthURL is JoinURL for requests carrying credentials meant for base. Absolute apipath
+// on other scheme or host than base is rejected, so credentials are not sent to other hosts.
+func joinAuthURL(base, apipath string) (string, error) {
+	apiurl, err := JoinURL(base, apipath)
+	if err != nil {
+		return "", err
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(apiurl)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(u.Scheme, b.Scheme) || !strings.EqualFold(u.Host, b.Host) {
+		return "", fmt.Errorf("API path %q is not on host of base URL, credentials are not sent to other hosts; use URL methods like GetURL to call them", apipath)
+	}
+	return apiurl, nil
+}
@@ -0,0 +1,130 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base    string
+		apipath string
+		exp     string
+	}{
+		{"https://host", "/users", "https://host/users"},
+		{"https://host/", "users", "https://host/users"},
+		{"https://host/api/v1", "/users", "https://host/api/v1/users"},
+		{"https://host/api/v1/", "/users", "https://host/api/v1/users"},
+		{"https://host/api/v1//", "//users", "https://host/api/v1//users"},
+		{"https://host/api/v1", "users/1/orders?page=2", "https://host/api/v1/users/1/orders?page=2"},
+		{"https://host/api/v1?key=k", "/users", "https://host/api/v1/users?key=k"},
+		{"https://host/api/v1?key=k", "/users?page=2", "https://host/api/v1/users?key=k&page=2"},
+		{"https://host/api/v1?key=k", "?page=2", "https://host/api/v1?key=k&page=2"},
+		{"https://host/api/v1", "", "https://host/api/v1"},
+		{"https://host/api/v1", "../v2/users", "https://host/api/v2/users"},
+		{"https://host/api/v1", "./users", "https://host/api/v1/users"},
+		{"https://host/api/v1", "users:search", "https://host/api/v1/users:search"},
+		{"https://host/api/v1", "users/a%2Fb", "https://host/api/v1/users/a%2Fb"},
+		{"https://host/api/v1", "/users#top", "https://host/api/v1/users#top"},
+		{"https://host/api/v1", "https://other/x?y=1", "https://other/x?y=1"},
+		{"http://host:8080/api", "health", "http://host:8080/api/health"},
+	}
+	for _, tc := range tests {
+		got, err := JoinURL(tc.base, tc.apipath)
+		if err != nil {
+			t.Errorf("JoinURL(%q, %q) error: %v", tc.base, tc.apipath, err)
+			continue
+		}
+		if got != tc.exp {
+			t.Errorf("JoinURL(%q, %q): Expected: %s,  Got: %s", tc.base, tc.apipath, tc.exp, got)
+		}
+	}
+
+	bad := []struct {
+		base    string
+		apipath string
+	}{
+		{"", "/users"},
+		{"host/api", "/users"},
+		{"https://host", "/users%zz"},
+		{"https://host%zz", "/users"},
+	}
+	for _, tc := range bad {
+		if got, err := JoinURL(tc.base, tc.apipath); err == nil {
+			t.Errorf("JoinURL(%q, %q): Expected error,  Got: %s", tc.base, tc.apipath, got)
+		}
+	}
+}
+
+func TestBaseURLValidation(t *testing.T) {
+	tests := []struct {
+		base  string
+		valid bool
+	}{
+		{"https://host/api", true},
+		{"http://host:8080", true},
+		{"host/api", false},
+		{"//host/api", false},
+		{"ftp://host", false},
+		{"https://host/api#v1", false},
+		{"https://ho st", false},
+		{"https://host:port", false},
+	}
+	for _, tc := range tests {
+		_, err := NewAPI(tc.base)
+		if (err == nil) != tc.valid {
+			t.Errorf("NewAPI(%q): Expected valid %t,  Got: %v", tc.base, tc.valid, err)
+		}
+	}
+}
+
+func TestCredentialsNotSentToOtherHost(t *testing.T) {
+	var leaked int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt32(&leaked, 1)
+		}
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "own"})
+	}))
+	defer srv.Close()
+
+	j, _ := NewJwtAPI(srv.URL+"/api", srv.URL+"/token")
+	basic, _ := NewAPI(srv.URL, WithBasicAuth("svc", "pwd"))
+	open, _ := NewAPI(srv.URL)
+	ctx := context.Background()
+
+	foreign := other.URL + "/steal"
+	calls := []struct {
+		name string
+		call func() error
+		ok   bool
+	}{
+		{"JwtAPI.Get", func() error { _, err := j.Get(foreign); return err }, false},
+		{"JwtAPI.Post", func() error { _, err := j.Post(foreign, []byte("{}")); return err }, false},
+		{"JwtAPI.R", func() error { _, err := j.R().Get(ctx, foreign); return err }, false},
+		{"JwtAPI.Stream", func() error { _, err := j.Stream(ctx, http.MethodGet, foreign, nil); return err }, false},
+		{"API basic-auth", func() error { _, err := basic.Get(foreign); return err }, false},
+		{"JwtAPI same host", func() error { _, err := j.Get(srv.URL + "/other"); return err }, true},
+		{"API without credentials", func() error { _, err := open.Get(foreign); return err }, true},
+	}
+	for _, tc := range calls {
+		err := tc.call()
+		if tc.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "not on host")) {
+			t.Errorf("%s: Expected error for other host,  Got: %v", tc.name, err)
+		}
+	}
+	if n := atomic.LoadInt32(&leaked); n != 0 {
+		t.Errorf("Expected no credentials sent to other host,  Got %d requests", n)
+	}
+}
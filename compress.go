@@ -0,0 +1,209 @@
+package apiclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultCompressMinSize is smallest request body compressed when MinSize of Compression is not set
+const defaultCompressMinSize = 1 << 10
+
+// Compression configure compression of request bodies and decompression of responses. When set on API or
+// JwtAPI, requests ask for gzip or deflate responses, unless Accept-Encoding is already set e.g. by SetHeaders,
+// and responses with gzip or deflate Content-Encoding are decompressed before they are returned.
+type Compression struct {
+	// Encoding of request bodies, "gzip" or "deflate". Request bodies are sent as they are when empty.
+	Encoding string
+	// MinSize is smallest request body compressed, default 1 KiB. Bodies of unknown size are not compressed.
+	MinSize int64
+	// Stats, if set, is called for each compressed request body once it is sent, and for each
+	// compressed response body once it is read to end. It may be called from other goroutines.
+	Stats func(s CompressionStats)
+}
+
+// CompressionStats is size of a body before and after compression
+type CompressionStats struct {
+	// Response tells if body is of response, else of request
+	Response bool
+	Encoding string
+	// Size is length of uncompressed body, Compressed is length sent or received
+	Size       int64
+	Compressed int64
+}
+
+// Ratio returns compressed length as fraction of uncompressed length, 0 for empty body
+func (s CompressionStats) Ratio() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return float64(s.Compressed) / float64(s.Size)
+}
+
+// validate check settings of c, field is name of client field holding it
+func (c *Compression) validate(field string) error {
+	if c == nil {
+		return nil
+	}
+	switch c.Encoding {
+	case "", "gzip", "deflate":
+	default:
+		return configErr(field, "unsupported encoding %q, use gzip or deflate", c.Encoding)
+	}
+	if c.MinSize < 0 {
+		return configErr(field, "negative MinSize %d", c.MinSize)
+	}
+	return nil
+}
+
+// prepare ask for compressed response and compress body of r when it is large enough.
+// GetBody of r is changed to return compressed body too, so r can be retried.
+func (c *Compression) prepare(r *http.Request) {
+	if c == nil {
+		return
+	}
+	if r.Header.Get("Accept-Encoding") == "" {
+		r.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	minSize := c.MinSize
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+	if c.Encoding == "" || r.Body == nil || r.Body == http.NoBody || r.ContentLength <= 0 ||
+		r.ContentLength < minSize || r.Header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	r.Body = c.compress(r.Body)
+	if getBody := r.GetBody; getBody != nil {
+		r.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return c.compress(body), nil
+		}
+	}
+	r.ContentLength = -1
+	r.Header.Set("Content-Encoding", c.Encoding)
+}
+
+// compress returns body compressed while it is read, by a goroutine writing to a pipe
+func (c *Compression) compress(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		cw := &countWriter{w: pw}
+		var zw io.WriteCloser
+		if c.Encoding == "gzip" {
+			zw = gzip.NewWriter(cw)
+		} else {
+			zw = zlib.NewWriter(cw)
+		}
+		n, err := io.Copy(zw, body)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil && c.Stats != nil {
+			c.Stats(CompressionStats{Encoding: c.Encoding, Size: n, Compressed: cw.n})
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// decompress replace body of resp having gzip or deflate Content-Encoding with decompressed body
+func (c *Compression) decompress(resp *http.Response) {
+	if c == nil || resp == nil {
+		return
+	}
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch enc {
+	case "gzip", "x-gzip", "deflate":
+	default:
+		return
+	}
+	resp.Body = &decodedBody{enc: enc, body: resp.Body, cr: &countReader{r: resp.Body}, stats: c.Stats}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decodedBody decompress response body, its decompressor is created on first read so
+// empty bodies, e.g. of HEAD requests, don't give error
+type decodedBody struct {
+	enc   string
+	body  io.ReadCloser
+	cr    *countReader
+	r     io.Reader
+	n     int64
+	err   error
+	stats func(s CompressionStats)
+}
+
+func (d *decodedBody) Read(b []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.r == nil {
+		if d.r, d.err = newDecompressor(d.enc, d.cr); d.err != nil {
+			return 0, d.err
+		}
+	}
+	n, err := d.r.Read(b)
+	d.n += int64(n)
+	if err == io.EOF && d.stats != nil {
+		d.stats(CompressionStats{Response: true, Encoding: d.enc, Size: d.n, Compressed: d.cr.n})
+	}
+	if err != nil {
+		d.err = err
+	}
+	return n, err
+}
+
+func (d *decodedBody) Close() error {
+	return d.body.Close()
+}
+
+// newDecompressor returns reader decompressing r. deflate is read as zlib stream (RFC 1950) as
+// required by HTTP, or as raw deflate stream sent by some servers.
+func newDecompressor(enc string, r io.Reader) (io.Reader, error) {
+	if enc != "deflate" {
+		return gzip.NewReader(r)
+	}
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// countWriter count bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// countReader count bytes read through it
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,159 @@
+package apiclient
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	payload := []byte(`{"items":"` + strings.Repeat("abcdefgh", 1000) + `"}`)
+
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: fmt.Sprintf("z-%d", n)})
+	})
+	// echo request body with its Content-Encoding, compressed as asked by ?enc
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		if extractToken(r) == "z-1" {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		case "deflate":
+			zr, err := zlib.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		data, _ := ioutil.ReadAll(body)
+		w.Header().Set("X-Request-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+
+		var out io.WriteCloser
+		switch r.URL.Query().Get("enc") {
+		case "gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			out = gzip.NewWriter(w)
+		case "deflate":
+			// raw deflate stream
+			w.Header().Set("Content-Encoding", "deflate")
+			out, _ = flate.NewWriter(w, flate.DefaultCompression)
+		case "zlib":
+			w.Header().Set("Content-Encoding", "deflate")
+			out = zlib.NewWriter(w)
+		default:
+			w.Write(data)
+			return
+		}
+		out.Write(data)
+		out.Close()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var stats []CompressionStats
+	collect := func(s CompressionStats) {
+		mu.Lock()
+		stats = append(stats, s)
+		mu.Unlock()
+	}
+
+	a, err := NewAPI(srv.URL, WithCompression(Compression{Encoding: "gzip", Stats: collect}))
+	if err != nil {
+		t.Fatalf("NewAPI error: %v", err)
+	}
+	tests := []struct {
+		path    string
+		body    []byte
+		reqEnc  string
+		respEnc string
+	}{
+		{"/echo?enc=gzip", payload, "gzip", "gzip"},
+		{"/echo?enc=deflate", payload, "gzip", "deflate"},
+		{"/echo?enc=zlib", payload, "gzip", "deflate"},
+		{"/echo", []byte(`{"small":true}`), "", ""},
+	}
+	for _, tc := range tests {
+		mu.Lock()
+		stats = nil
+		mu.Unlock()
+		res, err := a.Post(tc.path, tc.body)
+		if err != nil {
+			t.Errorf("%s: Post error: %v", tc.path, err)
+			continue
+		}
+		if res.Data != string(tc.body) {
+			t.Errorf("%s: Expected echoed body of %d bytes,  Got: %.40q", tc.path, len(tc.body), res.Data)
+		}
+		mu.Lock()
+		var sent, received bool
+		for _, s := range stats {
+			if s.Size != int64(len(tc.body)) || s.Ratio() >= 0.5 {
+				t.Errorf("%s: Expected stats for %d bytes compressed,  Got: %+v", tc.path, len(tc.body), s)
+			}
+			if s.Response {
+				received = s.Encoding == tc.respEnc
+			} else {
+				sent = s.Encoding == tc.reqEnc
+			}
+		}
+		mu.Unlock()
+		if sent != (tc.reqEnc != "") || received != (tc.respEnc != "") {
+			t.Errorf("%s: Expected stats for request %q and response %q,  Got: %+v", tc.path, tc.reqEnc, tc.respEnc, stats)
+		}
+	}
+
+	// compressed body is sent again after token is renewed, and Accept-Encoding set by SetHeaders is kept
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token", WithCompression(Compression{Encoding: "deflate", MinSize: 100}))
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	j.SetHeaders(map[string]string{"Accept-Encoding": "gzip"})
+	resp, err := j.Stream(context.Background(), http.MethodPost, "/echo?enc=gzip", strings.NewReader(string(payload)))
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != string(payload) || resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1 {
+		t.Errorf("Expected decompressed response,  Got: %d bytes, %q, length %d", len(data), resp.Header.Get("Content-Encoding"), resp.ContentLength)
+	}
+	if enc, accept := resp.Header.Get("X-Request-Encoding"), resp.Header.Get("X-Accept-Encoding"); enc != "deflate" || accept != "gzip" {
+		t.Errorf("Expected deflate request accepting gzip,  Got: %q accepting %q", enc, accept)
+	}
+	if n := atomic.LoadInt32(&logins); n != 2 {
+		t.Errorf("Expected request retried after login,  Got %d logins", n)
+	}
+
+	var cerr *ConfigError
+	if _, err := NewAPI(srv.URL, WithCompression(Compression{Encoding: "br"})); !errors.As(err, &cerr) || cerr.Field != "Compression" {
+		t.Errorf("Expected ConfigError for unsupported encoding,  Got: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config hold settings of API and JwtAPI, so they can be kept in a JSON file or environment
+// instead of code. Use NewAPIFromConfig or NewJwtAPIFromConfig to build clients from it.
+//
+// In JSON file keys are field names, and Profiles override settings for named environments:
+//
+//	{
+//		"ResourceAPIBaseURL": "https://api.dev.example.com",
+//		"TokenURI": "https://auth.dev.example.com/token",
+//		"ClientID": "orders",
+//		"ClientSecret": "${ORDERS_CLIENT_SECRET}",
+//		"Timeout": "10s",
+//		"Profiles": {
+//			"prod": {"ResourceAPIBaseURL": "https://api.example.com", "TokenURI": "https://auth.example.com/token"}
+//		}
+//	}
+//
+// In environment each field is read from variable named prefix, underscore and name in env tag of field,
+// e.g. ORDERS_BASE_URL. With a profile, e.g. prod, ORDERS_PROD_BASE_URL is preferred when set.
+type Config struct {
+	ResourceAPIBaseURL string `env:"BASE_URL"`
+	TokenURI           string `env:"TOKEN_URI"`
+	RefreshTokenURI    string `env:"REFRESH_TOKEN_URI"`
+	IssuerURL          string `env:"ISSUER_URL"`
+
+	ClientID     string `env:"CLIENT_ID"`
+	ClientSecret string `env:"CLIENT_SECRET"`
+	Scopes       string `env:"SCOPES"`
+	AppUserID    string `env:"APP_USER_ID"`
+
+	BasicAuthUser string `env:"BASIC_AUTH_USER"`
+	BasicAuthPwd  string `env:"BASIC_AUTH_PWD"`
+	UseNetrc      bool   `env:"USE_NETRC"`
+	NetrcPath     string `env:"NETRC_PATH"`
+
+	// Timeout and RetryWait are durations like "10s" or "500ms". MaxRetry of 0 means default, negative disable retries.
+	Timeout            string `env:"TIMEOUT"`
+	AllowInsecureSSL   bool   `env:"ALLOW_INSECURE_SSL"`
+	Debug              bool   `env:"DEBUG"`
+	StructuredResponse bool   `env:"STRUCTURED_RESPONSE"`
+	MaxRetry           int    `env:"MAX_RETRY"`
+	RetryWait          string `env:"RETRY_WAIT"`
+
+	// Compression is "gzip" or "deflate" to compress request bodies of at least CompressMinSize bytes,
+	// and decompress responses. "none" only decompress responses.
+	Compression     string `env:"COMPRESSION"`
+	CompressMinSize int    `env:"COMPRESS_MIN_SIZE"`
+
+	// Profiles hold settings overriding above ones, by profile name
+	Profiles map[string]json.RawMessage `json:",omitempty" env:"-"`
+}
+
+// envRef match ${NAME} references interpolated in string settings of config file
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadConfig read Config from JSON file at path, apply given profile if not empty and replace
+// ${NAME} in string settings with value of environment variable NAME
+func LoadConfig(path, profile string) (Config, error) {
+	var c Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("failed to read config: %v", err)
+	}
+	if err := decodeConfig(data, &c); err != nil {
+		return c, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	if profile != "" {
+		p, ok := c.Profiles[profile]
+		if !ok {
+			return c, configErr("Profiles", "profile %q not found in %s", profile, path)
+		}
+		if err := decodeConfig(p, &c); err != nil {
+			return c, fmt.Errorf("invalid profile %q in %s: %v", profile, path, err)
+		}
+	}
+	c.Profiles = nil
+
+	if err := c.interpolate(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// LoadConfigFromEnv read Config from environment variables with given prefix and profile
+func LoadConfigFromEnv(prefix, profile string) (Config, error) {
+	var c Config
+	err := c.LoadEnv(prefix, profile)
+	return c, err
+}
+
+// LoadEnv override settings of c with ones set in environment variables with given prefix and profile.
+// Variables not set leave settings unchanged.
+func (c *Config) LoadEnv(prefix, profile string) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("env")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := prefix + "_" + tag
+		val, ok := "", false
+		if profile != "" {
+			name = prefix + "_" + strings.ToUpper(profile) + "_" + tag
+			val, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			name = prefix + "_" + tag
+			val, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			continue
+		}
+
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(val)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return configErr(f.Name, "%s=%q is not a boolean", name, val)
+			}
+			fv.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return configErr(f.Name, "%s=%q is not a number", name, val)
+			}
+			fv.SetInt(int64(n))
+		}
+	}
+	return nil
+}
+
+// NewAPIFromConfig returns API built from c, opts are applied after settings of c.
+// Settings used only by JwtAPI are ignored.
+func NewAPIFromConfig(c Config, opts ...Option) (*API, error) {
+	copts, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	if c.BasicAuthUser != "" || c.BasicAuthPwd != "" {
+		copts = append(copts, WithBasicAuth(c.BasicAuthUser, c.BasicAuthPwd))
+	}
+	if c.UseNetrc {
+		copts = append(copts, WithNetrc(c.NetrcPath))
+	}
+	return NewAPI(c.ResourceAPIBaseURL, append(copts, opts...)...)
+}
+
+// NewJwtAPIFromConfig returns JwtAPI built from c, opts are applied after settings of c.
+// Basic-auth and netrc settings are rejected as JwtAPI does not use them.
+func NewJwtAPIFromConfig(c Config, opts ...Option) (*JwtAPI, error) {
+	copts, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	if c.BasicAuthUser != "" || c.BasicAuthPwd != "" {
+		return nil, configErr("BasicAuthUser", "basic-auth is not used by JwtAPI")
+	}
+	if c.UseNetrc {
+		return nil, configErr("UseNetrc", "netrc is not used by JwtAPI")
+	}
+	treq := TokenRequest{ClientID: c.ClientID, ClientSecret: c.ClientSecret, Scopes: c.Scopes, AppUserID: c.AppUserID}
+	copts = append(copts, WithTokenRequest(treq))
+	if c.RefreshTokenURI != "" {
+		copts = append(copts, WithRefreshTokenURI(c.RefreshTokenURI))
+	}
+	if c.IssuerURL != "" {
+		copts = append(copts, WithIssuer(c.IssuerURL))
+	}
+	return NewJwtAPI(c.ResourceAPIBaseURL, c.TokenURI, append(copts, opts...)...)
+}
+
+// options returns Options for settings common to API and JwtAPI
+func (c Config) options() ([]Option, error) {
+	timeout, err := parseConfigDuration("Timeout", c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := parseConfigDuration("RetryWait", c.RetryWait)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []Option{WithTimeout(timeout), func(s *settings) error {
+		*s.maxRetry = c.MaxRetry
+		*s.retryWait = wait
+		return nil
+	}}
+	if c.AllowInsecureSSL {
+		opts = append(opts, WithInsecureSSL())
+	}
+	if c.Debug {
+		opts = append(opts, WithDebug())
+	}
+	if c.StructuredResponse {
+		opts = append(opts, WithStructuredResponse())
+	}
+	if c.Compression != "" {
+		enc := c.Compression
+		if enc == "none" {
+			enc = ""
+		}
+		opts = append(opts, WithCompression(Compression{Encoding: enc, MinSize: int64(c.CompressMinSize)}))
+	}
+	return opts, nil
+}
+
+// interpolate replace ${NAME} in string settings with value of environment variable NAME
+func (c *Config) interpolate() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fv := v.Field(i)
+		if fv.Kind() != reflect.String {
+			continue
+		}
+		var missing string
+		s := envRef.ReplaceAllStringFunc(fv.String(), func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return val
+		})
+		if missing != "" {
+			return configErr(t.Field(i).Name, "environment variable %s is not set", missing)
+		}
+		fv.SetString(s)
+	}
+	return nil
+}
+
+// decodeConfig decode JSON data over c, rejecting unknown settings
+func decodeConfig(data []byte, c *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		if terr, ok := err.(*json.UnmarshalTypeError); ok && terr.Field != "" {
+			return configErr(terr.Field, "expected %v, got JSON %s", terr.Type, terr.Value)
+		}
+		return err
+	}
+	return nil
+}
+
+func parseConfigDuration(field, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, configErr(field, "%q is not a duration like \"10s\"", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,104 @@
+package apiclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "client.json")
+	ioutil.WriteFile(path, []byte(`{
+		"ResourceAPIBaseURL": "https://api.dev.example.com",
+		"TokenURI": "https://auth.dev.example.com/token",
+		"ClientID": "orders",
+		"ClientSecret": "${APICLIENT_TEST_SECRET}",
+		"Timeout": "5s",
+		"Profiles": {
+			"prod": {"ResourceAPIBaseURL": "https://api.example.com", "Timeout": "30s"}
+		}
+	}`), 0600)
+
+	os.Setenv("APICLIENT_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("APICLIENT_TEST_SECRET")
+
+	c, err := LoadConfig(path, "prod")
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	j, err := NewJwtAPIFromConfig(c)
+	if err != nil {
+		t.Fatalf("NewJwtAPIFromConfig error: %v", err)
+	}
+	if j.ResourceAPIBaseURL != "https://api.example.com" || j.TokenURI != "https://auth.dev.example.com/token" {
+		t.Errorf("Expected prod base URL and shared token URI,  Got: %s, %s", j.ResourceAPIBaseURL, j.TokenURI)
+	}
+	if j.Timeout != 30*time.Second || j.TokenRequestData.ClientSecret != "s3cr3t" {
+		t.Errorf("Expected 30s timeout and interpolated secret,  Got: %v, %q", j.Timeout, j.TokenRequestData.ClientSecret)
+	}
+
+	if _, err := LoadConfig(path, "staging"); err == nil {
+		t.Errorf("Expected error for missing profile")
+	}
+	os.Unsetenv("APICLIENT_TEST_SECRET")
+	var cerr *ConfigError
+	if _, err := LoadConfig(path, ""); !errors.As(err, &cerr) || cerr.Field != "ClientSecret" {
+		t.Errorf("Expected ClientSecret error for unset variable,  Got: %v", err)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"BILLING_BASE_URL":        "https://billing.dev.example.com",
+		"BILLING_PROD_BASE_URL":   "https://billing.example.com",
+		"BILLING_BASIC_AUTH_USER": "ops",
+		"BILLING_MAX_RETRY":       "-1",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c, err := LoadConfigFromEnv("BILLING", "prod")
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv error: %v", err)
+	}
+	a, err := NewAPIFromConfig(c)
+	if err != nil {
+		t.Fatalf("NewAPIFromConfig error: %v", err)
+	}
+	if a.ResourceAPIBaseURL != "https://billing.example.com" || a.BasicAuthUser != "ops" || a.MaxRetry != -1 {
+		t.Errorf("Expected prod settings from env,  Got: %s, %s, %d", a.ResourceAPIBaseURL, a.BasicAuthUser, a.MaxRetry)
+	}
+
+	tests := []struct {
+		c     Config
+		field string
+	}{
+		{Config{ResourceAPIBaseURL: "billing.example.com"}, "ResourceAPIBaseURL"},
+		{Config{ResourceAPIBaseURL: "https://billing.example.com", Timeout: "10"}, "Timeout"},
+		{Config{ResourceAPIBaseURL: "https://billing.example.com", BasicAuthPwd: "pwd"}, "BasicAuthUser"},
+	}
+	for _, tc := range tests {
+		var cerr *ConfigError
+		if _, err := NewAPIFromConfig(tc.c); !errors.As(err, &cerr) || cerr.Field != tc.field {
+			t.Errorf("Expected %s error,  Got: %v", tc.field, err)
+		}
+	}
+
+	os.Setenv("BILLING_DEBUG", "sometimes")
+	defer os.Unsetenv("BILLING_DEBUG")
+	var cerr *ConfigError
+	if _, err := LoadConfigFromEnv("BILLING", ""); !errors.As(err, &cerr) || cerr.Field != "Debug" {
+		t.Errorf("Expected Debug error,  Got: %v", err)
+	}
+}
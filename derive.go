@@ -0,0 +1,142 @@
+package apiclient
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Auth set credentials to outgoing requests of a client derived by WithAuth
+type Auth interface {
+	Apply(r *http.Request) error
+}
+
+// AuthFunc is Auth calling the function itself
+type AuthFunc func(r *http.Request) error
+
+// Apply calls f(r)
+func (f AuthFunc) Apply(r *http.Request) error {
+	return f(r)
+}
+
+// BasicAuth returns Auth sending basic-auth credentials, password is taken from pwd at request time
+func BasicAuth(user string, pwd SecretProvider) Auth {
+	return AuthFunc(func(r *http.Request) error {
+		p, err := pwd.Secret(r.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get basic-auth password: %v", err)
+		}
+		r.SetBasicAuth(user, p)
+		return nil
+	})
+}
+
+// BearerAuth returns Auth sending token taken from token at request time as bearer token
+func BearerAuth(token SecretProvider) Auth {
+	return AuthFunc(func(r *http.Request) error {
+		t, err := token.Secret(r.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get bearer token: %v", err)
+		}
+		r.Header.Set("Authorization", "Bearer "+t)
+		return nil
+	})
+}
+
+// WithHeader returns copy of a sending header k with value v in addition to headers of a.
+// a is not changed, and both share connections.
+func (a *API) WithHeader(k, v string) *API {
+	c := *a
+	c.headers = withHeader(a.headers, k, v)
+	return &c
+}
+
+// WithBaseURL returns copy of a calling APIs under baseURL
+func (a *API) WithBaseURL(baseURL string) (*API, error) {
+	if err := validateURL("ResourceAPIBaseURL", baseURL); err != nil {
+		return nil, err
+	}
+	c := *a
+	c.ResourceAPIBaseURL = baseURL
+	return &c, nil
+}
+
+// WithTimeout returns copy of a using timeout d for requests, sharing connections with a
+func (a *API) WithTimeout(d time.Duration) *API {
+	c := *a
+	c.Timeout = d
+	c.client = withClientTimeout(a.client, d)
+	return &c
+}
+
+// WithAuth returns copy of a setting credentials by auth in place of basic-auth settings of a
+func (a *API) WithAuth(auth Auth) *API {
+	c := *a
+	c.auth = auth
+	return &c
+}
+
+// WithHeader returns copy of j sending header k with value v in addition to headers of j.
+// j is not changed, and both share connections and tokens.
+func (j *JwtAPI) WithHeader(k, v string) *JwtAPI {
+	c := j.derive()
+	c.headers = withHeader(j.headers, k, v)
+	return c
+}
+
+// WithBaseURL returns copy of j calling APIs under baseURL, sharing tokens with j
+func (j *JwtAPI) WithBaseURL(baseURL string) (*JwtAPI, error) {
+	if err := validateURL("ResourceAPIBaseURL", baseURL); err != nil {
+		return nil, err
+	}
+	c := j.derive()
+	c.ResourceAPIBaseURL = baseURL
+	return c, nil
+}
+
+// WithTimeout returns copy of j using timeout d for requests, sharing connections and tokens with j
+func (j *JwtAPI) WithTimeout(d time.Duration) *JwtAPI {
+	c := j.derive()
+	c.Timeout = d
+	c.client = withClientTimeout(j.client, d)
+	return c
+}
+
+// WithAuth returns copy of j setting credentials by auth in place of its tokens, e.g. for APIs
+// accepting API-key. Requests rejected with 401 are not retried as there is no token to renew.
+func (j *JwtAPI) WithAuth(auth Auth) *JwtAPI {
+	c := j.derive()
+	c.auth = auth
+	return c
+}
+
+// derive returns copy of j sharing its token store
+func (j *JwtAPI) derive() *JwtAPI {
+	j.tokens()
+	c := *j
+	return &c
+}
+
+// withHeader returns copy of headers with k set to v
+func withHeader(headers map[string]string, k, v string) map[string]string {
+	k = http.CanonicalHeaderKey(k)
+	h := make(map[string]string, len(headers)+1)
+	for hk, hv := range headers {
+		if http.CanonicalHeaderKey(hk) != k {
+			h[hk] = hv
+		}
+	}
+	h[k] = v
+	return h
+}
+
+// withClientTimeout returns copy of client with timeout d, sharing its transport.
+// nil is returned for nil client, which is built for each request.
+func withClientTimeout(client *http.Client, d time.Duration) *http.Client {
+	if client == nil {
+		return nil
+	}
+	c := *client
+	c.Timeout = clientTimeout(d)
+	return &c
+}
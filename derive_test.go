@@ -0,0 +1,100 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeriveClients(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: "shared", ExpiresIn: "3600"})
+	})
+	mux.HandleFunc("/v1/whoami", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: r.Header.Get("X-Tenant") + "/" + r.Header.Get("Authorization")})
+	})
+	mux.HandleFunc("/v2/whoami", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: "v2"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL+"/v1", srv.URL+"/token", WithStructuredResponse())
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	v2, err := j.WithBaseURL(srv.URL + "/v2")
+	if err != nil {
+		t.Fatalf("WithBaseURL error: %v", err)
+	}
+	if _, err := j.WithBaseURL("localhost:8080"); err == nil {
+		t.Errorf("Expected error for base URL without scheme")
+	}
+
+	clients := []struct {
+		c   *JwtAPI
+		exp string
+	}{
+		{j, "/bearer shared"},
+		{j.WithHeader("x-tenant", "acme"), "acme/bearer shared"},
+		{j.WithHeader("X-Tenant", "globex").WithTimeout(time.Second), "globex/bearer shared"},
+		{j.WithAuth(BearerAuth(StaticSecret("api-key"))), "/Bearer api-key"},
+		{v2, "v2"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for _, tc := range clients {
+			wg.Add(1)
+			go func(c *JwtAPI, exp string) {
+				defer wg.Done()
+				res, err := c.Get("/whoami")
+				if err != nil || res.Data != exp {
+					t.Errorf("Expected: %s,  Got: %s (%v)", exp, res.Data, err)
+				}
+			}(tc.c, tc.exp)
+		}
+	}
+	wg.Wait()
+
+	if logins != 1 {
+		t.Errorf("Expected token shared by derived clients,  Got logins: %d", logins)
+	}
+	if len(j.headers) != 0 {
+		t.Errorf("Expected parent headers unchanged,  Got: %v", j.headers)
+	}
+}
+
+func TestDeriveAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pwd, _ := r.BasicAuth()
+		w.Write([]byte(r.Header.Get("X-Request-Id") + ":" + user + ":" + pwd))
+	}))
+	defer srv.Close()
+
+	a, err := NewAPI(srv.URL, WithBasicAuth("ops", "opspwd"))
+	if err != nil {
+		t.Fatalf("NewAPI error: %v", err)
+	}
+	tests := []struct {
+		a   *API
+		exp string
+	}{
+		{a, ":ops:opspwd"},
+		{a.WithHeader("X-Request-Id", "r1"), "r1:ops:opspwd"},
+		{a.WithAuth(BasicAuth("admin", StaticSecret("adminpwd"))).WithHeader("X-Request-Id", "r2"), "r2:admin:adminpwd"},
+	}
+	for _, tc := range tests {
+		res, err := tc.a.Get("/")
+		if err != nil || res.Data != tc.exp {
+			t.Errorf("Expected: %s,  Got: %s (%v)", tc.exp, res.Data, err)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadResume keep partial download in dst+".part" when transfer fails, and continue it with Range
+// request instead of starting again. Interrupted transfer is resumed as per MaxRetry and RetryWait of
+// the client, and partial file left by a failed Download is resumed by next Download to same dst.
+// Server must send strong ETag or Last-Modified, which is checked by If-Range so a changed resource is
+// downloaded again in full. Full download is also done when server ignores Range.
+func DownloadResume() DownloadOption {
+	return func(d *downloadConfig) {
+		d.resume = true
+	}
+}
+
+// DownloadParallel fetch file in n chunks concurrently with Range requests. File is downloaded with a
+// single request when server does not support Range. Each chunk is resumed as per MaxRetry and RetryWait
+// of the client when its transfer fails, but partial files are not kept across calls.
+func DownloadParallel(n int) DownloadOption {
+	return func(d *downloadConfig) {
+		d.parallel = n
+	}
+}
+
+// partMeta is saved next to partial download, to validate the resource when download is resumed
+type partMeta struct {
+	// Validator is strong ETag or Last-Modified of resource
+	Validator string
+	// Size is full length of resource, -1 if unknown
+	Size int64
+}
+
+// errRangeRestart is returned when server could not continue partial download, which is started again
+var errRangeRestart = errors.New("server could not resume partial download")
+
+// downloadResume download to dst through partial file which is kept when transfer fails
+func downloadResume(ctx context.Context, d downloader, dst string, cfg downloadConfig) (int64, error) {
+	part := dst + ".part"
+	metaPath := part + ".json"
+
+	var size int64
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		var err error
+		size, retry, err = resumeOnce(ctx, d, part, metaPath, cfg)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= d.retries || ctx.Err() != nil {
+			return size, err
+		}
+		select {
+		case <-ctx.Done():
+			return size, ctx.Err()
+		case <-time.After(d.retryWait):
+		}
+	}
+
+	if err := verifyChecksum(part, cfg); err != nil {
+		// content is wrong, don't resume it
+		os.Remove(part)
+		os.Remove(metaPath)
+		return size, err
+	}
+	if err := os.Rename(part, dst); err != nil {
+		return size, err
+	}
+	os.Remove(metaPath)
+	return size, nil
+}
+
+// resumeOnce continue partial download from its current length, and returns size of partial file.
+// retry tells if error is failed transfer, which can be resumed.
+func resumeOnce(ctx context.Context, d downloader, part, metaPath string, cfg downloadConfig) (int64, bool, error) {
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create download file: %v", err)
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, err
+	}
+	meta := readPartMeta(metaPath)
+
+	header := http.Header{"Accept-Encoding": {"identity"}}
+	if offset > 0 && meta.Validator != "" {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		header.Set("If-Range", meta.Validator)
+	} else {
+		offset = 0
+	}
+
+	resp, err := d.stream(ctx, header)
+	if err != nil {
+		return offset, true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			restartPart(f, metaPath)
+			return 0, true, errRangeRestart
+		}
+		if meta.Size < 0 {
+			meta.Size = total
+		}
+	case http.StatusOK:
+		// range ignored or resource changed, download again in full
+		offset = 0
+		if err := f.Truncate(0); err != nil {
+			return 0, false, err
+		}
+		meta = partMeta{Validator: rangeValidator(resp.Header), Size: resp.ContentLength}
+		if err := writePartMeta(metaPath, meta); err != nil {
+			return 0, false, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if _, _, total, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && total == offset {
+			// partial file is already complete
+			return offset, false, nil
+		}
+		restartPart(f, metaPath)
+		return 0, true, errRangeRestart
+	default:
+		return offset, false, downloadError(resp)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, false, err
+	}
+	var w io.Writer = f
+	if cfg.progress != nil {
+		base, total := offset, meta.Size
+		w = &progressWriter{w: f, progress: func(done int64) { cfg.progress(base+done, total) }}
+	}
+	n, err := io.Copy(w, resp.Body)
+	size := offset + n
+	if err != nil {
+		return size, true, fmt.Errorf("download failed after %d bytes: %v", size, err)
+	}
+	if meta.Size >= 0 && size != meta.Size {
+		return size, true, fmt.Errorf("download incomplete: got %d of %d bytes", size, meta.Size)
+	}
+	if err := f.Sync(); err != nil {
+		return size, false, fmt.Errorf("failed to write download file: %v", err)
+	}
+	return size, false, nil
+}
+
+// restartPart empty partial file and forget its validator, so it is downloaded again in full
+func restartPart(f *os.File, metaPath string) {
+	f.Truncate(0)
+	os.Remove(metaPath)
+}
+
+// downloadParallel download to dst in cfg.parallel chunks fetched concurrently
+func downloadParallel(ctx context.Context, d downloader, dst string, cfg downloadConfig) (int64, error) {
+	// first byte tells if ranges are supported, and size of resource
+	header := http.Header{"Accept-Encoding": {"identity"}, "Range": {"bytes=0-0"}}
+	resp, err := d.stream(ctx, header)
+	if err != nil {
+		return 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// ranges not supported, this is full download
+		defer resp.Body.Close()
+		return saveDownload(resp, dst, cfg)
+	case http.StatusPartialContent:
+		resp.Body.Close()
+	case http.StatusRequestedRangeNotSatisfiable:
+		// empty resource
+		resp.Body.Close()
+		return downloadFull(ctx, d, dst, cfg)
+	default:
+		defer resp.Body.Close()
+		return 0, downloadError(resp)
+	}
+
+	_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil || total < 0 {
+		// size unknown, can't split in chunks
+		return downloadFull(ctx, d, dst, cfg)
+	}
+	validator := rangeValidator(resp.Header)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create download file: %v", err)
+	}
+	err = fetchChunks(ctx, d, tmp, total, validator, cfg)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err == nil {
+		err = verifyChecksum(tmp.Name(), cfg)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return total, nil
+}
+
+// fetchChunks download total bytes into f in cfg.parallel concurrent chunks
+func fetchChunks(ctx context.Context, d downloader, f *os.File, total int64, validator string, cfg downloadConfig) error {
+	if err := f.Truncate(total); err != nil {
+		return fmt.Errorf("failed to create download file: %v", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var done int64
+	progress := func(n int64) {
+		if cfg.progress == nil {
+			return
+		}
+		mu.Lock()
+		done += n
+		cfg.progress(done, total)
+		mu.Unlock()
+	}
+
+	chunk := (total + int64(cfg.parallel) - 1) / int64(cfg.parallel)
+	errs := make(chan error, cfg.parallel)
+	var wg sync.WaitGroup
+	for start := int64(0); start < total; start += chunk {
+		end := start + chunk
+		if end > total {
+			end = total
+		}
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			if err := fetchChunk(ctx, d, f, start, end, validator, progress); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// fetchChunk download bytes [start, end) into f, resuming transfer from where it failed
+func fetchChunk(ctx context.Context, d downloader, f *os.File, start, end int64, validator string, progress func(n int64)) error {
+	offset := start
+	for attempt := 0; ; attempt++ {
+		header := http.Header{
+			"Accept-Encoding": {"identity"},
+			"Range":           {fmt.Sprintf("bytes=%d-%d", offset, end-1)},
+		}
+		if validator != "" {
+			header.Set("If-Range", validator)
+		}
+		resp, err := d.stream(ctx, header)
+		if err == nil {
+			var n int64
+			n, err = copyChunk(resp, f, offset, end, progress)
+			offset += n
+			if err == nil {
+				return nil
+			}
+			if resp.StatusCode != http.StatusPartialContent {
+				return err
+			}
+		}
+		if attempt >= d.retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.retryWait):
+		}
+	}
+}
+
+// copyChunk write body of 206 response for range starting at offset into f, upto end
+func copyChunk(resp *StreamResponse, f *os.File, offset, end int64, progress func(n int64)) (int64, error) {
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return 0, fmt.Errorf("resource changed while downloading in parallel")
+	default:
+		return 0, downloadError(resp)
+	}
+	if start, _, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != offset {
+		return 0, fmt.Errorf("unexpected Content-Range %q for chunk at %d", resp.Header.Get("Content-Range"), offset)
+	}
+
+	w := &chunkWriter{w: &offsetWriter{f: f, offset: offset}, progress: progress}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, end-offset))
+	if err == nil && offset+n != end {
+		err = fmt.Errorf("download incomplete: chunk at %d got %d of %d bytes", offset, n, end-offset)
+	}
+	return n, err
+}
+
+// offsetWriter write to f from offset onwards
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (o *offsetWriter) Write(b []byte) (int, error) {
+	n, err := o.f.WriteAt(b, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
+
+// chunkWriter report size of each write to progress
+type chunkWriter struct {
+	w        io.Writer
+	progress func(n int64)
+}
+
+func (c *chunkWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.progress(int64(n))
+	return n, err
+}
+
+// parseContentRange parse Content-Range header like "bytes 0-99/1000" or "bytes */1000".
+// start and end are -1 for unsatisfied range, and total is -1 when unknown.
+func parseContentRange(s string) (start, end, total int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", s)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, invalid
+	}
+	s = strings.TrimPrefix(s, "bytes ")
+	idx := strings.IndexByte(s, '/')
+	if idx < 0 {
+		return 0, 0, 0, invalid
+	}
+	rng, size := s[:idx], s[idx+1:]
+
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, 0, invalid
+		}
+	}
+	if rng == "*" {
+		return -1, -1, total, nil
+	}
+	idx = strings.IndexByte(rng, '-')
+	if idx < 0 {
+		return 0, 0, 0, invalid
+	}
+	if start, err = strconv.ParseInt(rng[:idx], 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+	if end, err = strconv.ParseInt(rng[idx+1:], 10, 64); err != nil || end < start {
+		return 0, 0, 0, invalid
+	}
+	return start, end, total, nil
+}
+
+// rangeValidator returns value for If-Range, strong ETag or Last-Modified, empty if response has neither
+func rangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+func readPartMeta(path string) partMeta {
+	meta := partMeta{Size: -1}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return meta
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return partMeta{Size: -1}
+	}
+	return meta
+}
+
+func writePartMeta(path string, meta partMeta) error {
+	data, _ := json.Marshal(meta)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save download state: %v", err)
+	}
+	return nil
+}
+
+// verifyChecksum compare checksum of file at path with cfg.checksum, if set
+func verifyChecksum(path string, cfg downloadConfig) error {
+	if cfg.newHash == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := cfg.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	return matchChecksum(h, cfg.checksum)
+}
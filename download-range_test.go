@@ -0,0 +1,202 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResumableDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte(strings.Repeat("0123456789abcdef", 4096))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var ranged, requests int32
+	// drop connection after half of body on first request to each path
+	var mu sync.Mutex
+	dropped := map[string]bool{}
+	drop := func(path string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		d := !dropped[path]
+		dropped[path] = true
+		return d
+	}
+	setDropped := func(path string, d bool) {
+		mu.Lock()
+		dropped[path] = d
+		mu.Unlock()
+	}
+	flaky := func(serve http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if r.Header.Get("Range") != "" {
+				atomic.AddInt32(&ranged, 1)
+			}
+			w.Header().Set("ETag", `"v2"`)
+			if drop(r.URL.Path) {
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				w.Write(content[:len(content)/2])
+				panic(http.ErrAbortHandler)
+			}
+			serve(w, r)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "dl"})
+	})
+	mux.HandleFunc("/file", flaky(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", modified, bytes.NewReader(content))
+	}))
+	mux.HandleFunc("/norange", flaky(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write(content)
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	a, err := NewAPI(srv.URL, WithRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewAPI error: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		path   string
+		stale  string
+		ranged int32
+	}{
+		{"resume", "/file", "", 1},
+		{"ignored range", "/norange", "", 1},
+		{"changed resource", "/file", `"v1"`, 1},
+	}
+	for _, tc := range tests {
+		setDropped(tc.path, false)
+		atomic.StoreInt32(&ranged, 0)
+		dst := filepath.Join(dir, strings.Replace(tc.name, " ", "-", -1))
+		if tc.stale != "" {
+			// partial file left by download of previous version
+			ioutil.WriteFile(dst+".part", []byte("stale"), 0600)
+			writePartMeta(dst+".part.json", partMeta{Validator: tc.stale, Size: 10})
+			setDropped(tc.path, true)
+		}
+
+		var done, total int64
+		n, err := a.Download(ctx, tc.path, dst, DownloadResume(), DownloadSHA256(checksum), DownloadProgress(func(d, t int64) { done, total = d, t }))
+		if err != nil {
+			t.Errorf("%s: Download error: %v", tc.name, err)
+			continue
+		}
+		got, _ := ioutil.ReadFile(dst)
+		if n != int64(len(content)) || !bytes.Equal(got, content) {
+			t.Errorf("%s: Expected %d bytes downloaded,  Got: %d, file %d bytes", tc.name, len(content), n, len(got))
+		}
+		if done != n || total != n {
+			t.Errorf("%s: Expected progress %d/%d,  Got: %d/%d", tc.name, n, n, done, total)
+		}
+		if r := atomic.LoadInt32(&ranged); r != tc.ranged {
+			t.Errorf("%s: Expected %d range requests,  Got: %d", tc.name, tc.ranged, r)
+		}
+		if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+			t.Errorf("%s: Expected partial file removed", tc.name)
+		}
+	}
+
+	// failed download keeps partial file to be resumed
+	dst := filepath.Join(dir, "kept")
+	setDropped("/file", false)
+	noRetry, _ := NewAPI(srv.URL, WithRetry(0, 0))
+	if _, err := noRetry.Download(ctx, "/file", dst, DownloadResume()); err == nil {
+		t.Errorf("Expected error for dropped connection without retry")
+	}
+	if fi, err := os.Stat(dst + ".part"); err != nil || fi.Size() != int64(len(content)/2) {
+		t.Fatalf("Expected partial file of %d bytes,  Got: %v %v", len(content)/2, fi, err)
+	}
+	atomic.StoreInt32(&requests, 0)
+	if _, err := noRetry.Download(ctx, "/file", dst, DownloadResume(), DownloadSHA256(checksum)); err != nil {
+		t.Errorf("Download error on resume: %v", err)
+	}
+	if r := atomic.LoadInt32(&requests); r != 1 {
+		t.Errorf("Expected single request to resume,  Got: %d", r)
+	}
+
+	// wait before retry ends when context is done
+	setDropped("/file", false)
+	slow, _ := NewAPI(srv.URL, WithRetry(2, time.Hour))
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := slow.Download(cctx, "/file", filepath.Join(dir, "cancelled"), DownloadResume()); err != context.DeadlineExceeded || time.Since(start) > 10*time.Second {
+		t.Errorf("Expected retry wait cancelled by context,  Got: %v after %v", err, time.Since(start))
+	}
+
+	// parallel chunks through JwtAPI
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token", WithRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	for _, path := range []string{"/file", "/norange"} {
+		setDropped(path, true)
+		atomic.StoreInt32(&ranged, 0)
+		dst := filepath.Join(dir, "parallel"+strings.TrimPrefix(path, "/"))
+		n, err := j.Download(ctx, path, dst, DownloadParallel(4), DownloadSHA256(checksum))
+		if err != nil {
+			t.Errorf("%s: parallel Download error: %v", path, err)
+			continue
+		}
+		got, _ := ioutil.ReadFile(dst)
+		if n != int64(len(content)) || !bytes.Equal(got, content) {
+			t.Errorf("%s: Expected %d bytes downloaded in parallel,  Got: %d, file %d bytes", path, len(content), n, len(got))
+		}
+	}
+	if r := atomic.LoadInt32(&ranged); r != 1 {
+		t.Errorf("Expected only probe request with range when ranges ignored,  Got: %d", r)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		in                string
+		start, end, total int64
+		invalid           bool
+	}{
+		{"bytes 0-99/1000", 0, 99, 1000, false},
+		{"bytes 100-199/*", 100, 199, -1, false},
+		{"bytes */1000", -1, -1, 1000, false},
+		{"bytes 9-1/10", 0, 0, 0, true},
+		{"items 0-1/2", 0, 0, 0, true},
+		{"bytes 0-1", 0, 0, 0, true},
+	}
+	for _, tc := range tests {
+		start, end, total, err := parseContentRange(tc.in)
+		if (err != nil) != tc.invalid {
+			t.Errorf("%q: Expected invalid %v,  Got: %v", tc.in, tc.invalid, err)
+			continue
+		}
+		if !tc.invalid && (start != tc.start || end != tc.end || total != tc.total) {
+			t.Errorf("%q: Expected %d-%d/%d,  Got: %d-%d/%d", tc.in, tc.start, tc.end, tc.total, start, end, total)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package apiclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxErrorBody is how much of a failed download response is read into error
+const maxErrorBody = 4 << 10
+
+// StreamResponse is response with body left to be read by caller, who must close Body
+type StreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+	// ContentLength is length of body, -1 if unknown
+	ContentLength int64
+}
+
+// DownloadOption configure Download
+type DownloadOption func(d *downloadConfig)
+
+type downloadConfig struct {
+	newHash  func() hash.Hash
+	checksum string
+	progress func(done, total int64)
+	resume   bool
+	parallel int
+}
+
+// DownloadChecksum verify downloaded file against hex encoded checksum computed by hash from newHash
+func DownloadChecksum(newHash func() hash.Hash, checksum string) DownloadOption {
+	return func(d *downloadConfig) {
+		d.newHash = newHash
+		d.checksum = checksum
+	}
+}
+
+// DownloadSHA256 verify downloaded file against hex encoded SHA-256 checksum
+func DownloadSHA256(checksum string) DownloadOption {
+	return DownloadChecksum(sha256.New, checksum)
+}
+
+// DownloadProgress call fn with number of bytes written so far and total size, -1 if unknown
+func DownloadProgress(fn func(done, total int64)) DownloadOption {
+	return func(d *downloadConfig) {
+		d.progress = fn
+	}
+}
+
+// streamFunc make request with given extra headers and returns response with unread body
+type streamFunc func(ctx context.Context, header http.Header) (*StreamResponse, error)
+
+// downloader make requests of a download through API or JwtAPI, and retry interrupted transfers
+// of resumable downloads as per retry settings of the client
+type downloader struct {
+	stream    streamFunc
+	retries   int
+	retryWait time.Duration
+}
+
+// Stream - make HTTP request with given method to api path and return response without reading its body.
+// body can be nil. apipath is joined to ResourceAPIBaseURL by JoinURL.
+func (a *API) Stream(ctx context.Context, method, apipath string, body io.Reader) (*StreamResponse, error) {
+	return a.stream(ctx, method, apipath, body, nil)
+}
+
+func (a *API) stream(ctx context.Context, method, apipath string, body io.Reader, header http.Header) (*StreamResponse, error) {
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.newRequest(ctx, method, apiurl)
+	if err != nil {
+		return nil, err
+	}
+	a.injectHeaders(r)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	resp, err := a.do(r)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamResponse(resp), nil
+}
+
+// Download - make HTTP GET request to api path and write response body to file dst. Body is written to
+// temporary file in directory of dst, which is renamed to dst after its length and checksum, if set, are verified.
+// File is created with permission 0600. Returns number of bytes written. apipath is joined to ResourceAPIBaseURL by JoinURL.
+func (a *API) Download(ctx context.Context, apipath, dst string, opts ...DownloadOption) (int64, error) {
+	stream := func(ctx context.Context, header http.Header) (*StreamResponse, error) {
+		return a.stream(ctx, http.MethodGet, apipath, nil, header)
+	}
+	return download(ctx, downloader{stream, retries(a.MaxRetry), retryWait(a.RetryWait)}, dst, opts)
+}
+
+// Stream - call api path with given method, auto inject Authorization Header and return response without
+// reading its body. body can be nil. apipath is joined to ResourceAPIBaseURL by JoinURL.
+func (j *JwtAPI) Stream(ctx context.Context, method, apipath string, body io.Reader) (*StreamResponse, error) {
+	return j.stream(ctx, method, apipath, body, nil)
+}
+
+func (j *JwtAPI) stream(ctx context.Context, method, apipath string, body io.Reader, header http.Header) (*StreamResponse, error) {
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.makeRequestHeader(ctx, method, apiurl, body, header)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	return newStreamResponse(resp), nil
+}
+
+// Download - call api path with GET method, auto inject Authorization Header and write response body to file dst.
+// See API.Download.
+func (j *JwtAPI) Download(ctx context.Context, apipath, dst string, opts ...DownloadOption) (int64, error) {
+	stream := func(ctx context.Context, header http.Header) (*StreamResponse, error) {
+		return j.stream(ctx, http.MethodGet, apipath, nil, header)
+	}
+	return download(ctx, downloader{stream, retries(j.MaxRetry), retryWait(j.RetryWait)}, dst, opts)
+}
+
+func newStreamResponse(resp *http.Response) *StreamResponse {
+	return &StreamResponse{
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		Body:          resp.Body,
+		ContentLength: resp.ContentLength,
+	}
+}
+
+// download write body of response returned by stream to dst through a temporary file
+func download(ctx context.Context, d downloader, dst string, opts []DownloadOption) (int64, error) {
+	var cfg downloadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.parallel > 1 {
+		return downloadParallel(ctx, d, dst, cfg)
+	}
+	if cfg.resume {
+		return downloadResume(ctx, d, dst, cfg)
+	}
+	return downloadFull(ctx, d, dst, cfg)
+}
+
+// downloadFull download to dst with a single request
+func downloadFull(ctx context.Context, d downloader, dst string, cfg downloadConfig) (int64, error) {
+	resp, err := d.stream(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, downloadError(resp)
+	}
+	return saveDownload(resp, dst, cfg)
+}
+
+// saveDownload write body of resp to dst through a temporary file
+func saveDownload(resp *StreamResponse, dst string, cfg downloadConfig) (int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create download file: %v", err)
+	}
+	n, err := writeDownload(tmp, resp, cfg)
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to write download file: %v", cerr)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+// writeDownload copy body of resp to f and verify its length and checksum
+func writeDownload(f *os.File, resp *StreamResponse, cfg downloadConfig) (int64, error) {
+	var w io.Writer = f
+	var h hash.Hash
+	if cfg.newHash != nil {
+		h = cfg.newHash()
+		w = io.MultiWriter(f, h)
+	}
+	if cfg.progress != nil {
+		total := resp.ContentLength
+		w = &progressWriter{w: w, progress: func(done int64) { cfg.progress(done, total) }}
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("download failed after %d bytes: %v", n, err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return n, fmt.Errorf("download incomplete: got %d of %d bytes", n, resp.ContentLength)
+	}
+	if h != nil {
+		if err := matchChecksum(h, cfg.checksum); err != nil {
+			return n, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return n, fmt.Errorf("failed to write download file: %v", err)
+	}
+	return n, nil
+}
+
+// matchChecksum compare sum of h with hex encoded checksum
+func matchChecksum(h hash.Hash, checksum string) error {
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("download checksum mismatch: expected %s, got %s", checksum, sum)
+	}
+	return nil
+}
+
+// downloadError returns error for not-ok response, with beginning of its body
+func downloadError(resp *StreamResponse) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return fmt.Errorf("download failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
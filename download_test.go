@@ -0,0 +1,107 @@
+package apiclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	export := strings.Repeat("id,name\n", 5000)
+	sum := sha256.Sum256([]byte(export))
+	checksum := hex.EncodeToString(sum[:])
+
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: fmt.Sprintf("dl-%d", n)})
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if extractToken(r) == "dl-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(export)))
+		w.Write([]byte(export))
+	})
+	mux.HandleFunc("/truncated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(export)))
+		w.Write([]byte(export[:100]))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such export", http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token")
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	ctx := context.Background()
+
+	dst := filepath.Join(dir, "export.csv")
+	var done, total int64
+	n, err := j.Download(ctx, "/export", dst, DownloadSHA256(strings.ToUpper(checksum)), DownloadProgress(func(d, t int64) { done, total = d, t }))
+	if err != nil {
+		t.Fatalf("Download error: %v", err)
+	}
+	got, _ := ioutil.ReadFile(dst)
+	if n != int64(len(export)) || string(got) != export {
+		t.Errorf("Expected %d bytes downloaded,  Got: %d, file %d bytes", len(export), n, len(got))
+	}
+	if done != n || total != n {
+		t.Errorf("Expected progress %d/%d,  Got: %d/%d", n, n, done, total)
+	}
+
+	tests := []struct {
+		path string
+		opts []DownloadOption
+		err  string
+	}{
+		{"/export", []DownloadOption{DownloadSHA256("00")}, "checksum mismatch"},
+		{"/truncated", nil, "download failed after 100 bytes"},
+		{"/missing", nil, "download failed (404): no such export"},
+	}
+	for _, tc := range tests {
+		failed := filepath.Join(dir, "failed.csv")
+		if _, err := j.Download(ctx, tc.path, failed, tc.opts...); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: Expected error: %s,  Got: %v", tc.path, tc.err, err)
+		}
+		if _, err := os.Stat(failed); !os.IsNotExist(err) {
+			t.Errorf("%s: Expected no file after failed download", tc.path)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected temporary files removed,  Got %d files", len(files))
+	}
+
+	a, _ := NewAPI(srv.URL)
+	resp, err := a.Stream(ctx, http.MethodGet, "/truncated", nil)
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	defer resp.Body.Close()
+	head := make([]byte, 8)
+	resp.Body.Read(head)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(export)) || string(head) != "id,name\n" {
+		t.Errorf("Expected streamed export,  Got: %d %d %q", resp.StatusCode, resp.ContentLength, head)
+	}
+}
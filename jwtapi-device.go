@@ -0,0 +1,186 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	// defaultDevicePollInterval is used when device authorization endpoint does not return interval
+	defaultDevicePollInterval = 5 * time.Second
+	// devicePollSlowDown is added to polling interval when auth-server respond with slow_down
+	devicePollSlowDown = 5 * time.Second
+)
+
+// DeviceCode is returned from device authorization endpoint, UserCode and VerificationURI
+// must be shown to user to complete login on another device
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// oauthError is error response returned by OAuth2 endpoints
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// RequestTokenByDeviceCode login user through OAuth2 device authorization grant (RFC 8628).
+// Device code is requested from DeviceAuthURI (or discovered endpoint) and passed to prompt,
+// which should show user-code and verification-uri to user.
+// TokenURI is then polled until user complete login, and received token is set to JwtAPI instance for subsequent calls.
+func (j *JwtAPI) RequestTokenByDeviceCode(ctx context.Context, prompt func(DeviceCode) error) (Token, error) {
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return Token{}, err
+	}
+	if j.GetDeviceAuthURI() == "" {
+		return Token{}, fmt.Errorf("DeviceAuthURI is not set")
+	}
+
+	dc, err := j.requestDeviceCode(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	if err := prompt(dc); err != nil {
+		return Token{}, err
+	}
+
+	token, err := j.pollDeviceToken(ctx, dc)
+	if err != nil {
+		return Token{}, err
+	}
+	if err := j.installToken(ctx, token, ""); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+func (j *JwtAPI) requestDeviceCode(ctx context.Context) (DeviceCode, error) {
+	var dc DeviceCode
+	treq := j.GetTokenRequestData()
+	form := url.Values{}
+	form.Set("client_id", treq.ClientID)
+	if treq.Scopes != "" {
+		form.Set("scope", strings.Join(parseScopes(treq.Scopes), " "))
+	}
+
+	resp, err := j.postForm(ctx, j.GetDeviceAuthURI(), form)
+	if err != nil {
+		return dc, fmt.Errorf("failed to get device code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return dc, fmt.Errorf("failed to get device code (%d): %v", resp.StatusCode, readOAuthError(resp))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&dc); err != nil {
+		return dc, fmt.Errorf("failed to extract device code: %v", err)
+	}
+	if dc.DeviceCode == "" || dc.UserCode == "" {
+		return dc, fmt.Errorf("device code response is missing device_code or user_code")
+	}
+	return dc, nil
+}
+
+func (j *JwtAPI) pollDeviceToken(ctx context.Context, dc DeviceCode) (Token, error) {
+	treq, err := j.GetTokenRequestData().resolve(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", grantTypeDeviceCode)
+	form.Set("device_code", dc.DeviceCode)
+	form.Set("client_id", treq.ClientID)
+	if treq.ClientSecret != "" {
+		form.Set("client_secret", treq.ClientSecret)
+	}
+
+	interval := defaultDevicePollInterval
+	if dc.Interval > 0 {
+		interval = time.Duration(dc.Interval) * time.Second
+	}
+	var expired <-chan time.Time
+	if dc.ExpiresIn > 0 {
+		timer := time.NewTimer(time.Duration(dc.ExpiresIn) * time.Second)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return Token{}, ctx.Err()
+		case <-expired:
+			return Token{}, fmt.Errorf("device code expired before user completed login")
+		case <-time.After(interval):
+		}
+
+		resp, err := j.postForm(ctx, j.GetTokenURI(), form)
+		if err != nil {
+			return Token{}, fmt.Errorf("failed to poll device token: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			token, err := j.decodeToken(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return token, fmt.Errorf("failed to extract new token: %v", err)
+			}
+			return token, nil
+		}
+
+		oerr := readOAuthError(resp)
+		resp.Body.Close()
+		switch oerr.Code {
+		case "authorization_pending":
+			j.logDebug("RequestTokenByDeviceCode", "authorization pending, polling again in %v", interval)
+		case "slow_down":
+			interval += devicePollSlowDown
+			j.logDebug("RequestTokenByDeviceCode", "slow down requested, polling again in %v", interval)
+		case "expired_token":
+			return Token{}, fmt.Errorf("device code expired before user completed login")
+		default:
+			return Token{}, fmt.Errorf("failed to get token by device code (%d): %v", resp.StatusCode, oerr)
+		}
+	}
+}
+
+// postForm post urlencoded form to given auth-server endpoint
+func (j *JwtAPI) postForm(ctx context.Context, uri string, form url.Values) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	return j.doTokenRequest(r)
+}
+
+// readOAuthError read OAuth2 error from response body, falling back to body as description
+func readOAuthError(resp *http.Response) oauthError {
+	var oerr oauthError
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &oerr); err != nil || oerr.Code == "" {
+		oerr.Code = http.StatusText(resp.StatusCode)
+		oerr.Description = string(body)
+	}
+	return oerr
+}
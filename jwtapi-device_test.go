@@ -0,0 +1,74 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeDeviceAuthServer returns auth-server which answer token polls with given errors before issuing token
+func fakeDeviceAuthServer(t *testing.T, pollErrors ...string) *httptest.Server {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "cli" {
+			t.Errorf("Expected client_id: cli,  Got: %s", r.FormValue("client_id"))
+		}
+		json.NewEncoder(w).Encode(DeviceCode{DeviceCode: "dev-123", UserCode: "ABCD-EFGH", VerificationURI: "http://auth/device", ExpiresIn: 60})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != grantTypeDeviceCode || r.FormValue("device_code") != "dev-123" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oauthError{Code: "invalid_grant"})
+			return
+		}
+		if polls < len(pollErrors) {
+			polls++
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oauthError{Code: pollErrors[polls-1]})
+			return
+		}
+		w.Write([]byte(`{"access_token":"device-token","expires_in":3600}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRequestTokenByDeviceCode(t *testing.T) {
+	defaultDevicePollInterval, devicePollSlowDown = time.Millisecond, time.Millisecond
+	defer func() { defaultDevicePollInterval, devicePollSlowDown = 5*time.Second, 5*time.Second }()
+
+	tests := []struct {
+		pollErrors []string
+		exp        string
+		fail       bool
+	}{
+		{[]string{"authorization_pending", "slow_down", "authorization_pending"}, "device-token", false},
+		{[]string{"authorization_pending", "expired_token"}, "", true},
+		{[]string{"access_denied"}, "", true},
+	}
+	for _, tc := range tests {
+		srv := fakeDeviceAuthServer(t, tc.pollErrors...)
+		j := &JwtAPI{TokenURI: srv.URL + "/token", DeviceAuthURI: srv.URL + "/device"}
+		j.TokenRequestData.ClientID = "cli"
+
+		userCode := ""
+		token, err := j.RequestTokenByDeviceCode(context.Background(), func(dc DeviceCode) error {
+			userCode = dc.UserCode
+			return nil
+		})
+		srv.Close()
+
+		if userCode != "ABCD-EFGH" {
+			t.Errorf("%v: Expected user code: ABCD-EFGH,  Got: %s", tc.pollErrors, userCode)
+		}
+		if (err != nil) != tc.fail {
+			t.Errorf("%v: Expected failure: %t,  Got: %v", tc.pollErrors, tc.fail, err)
+		}
+		if token.AccessToken != tc.exp || j.GetToken().AccessToken != tc.exp {
+			t.Errorf("%v: Expected: %s,  Got: %s", tc.pollErrors, tc.exp, token.AccessToken)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultDiscoveryTTL is used when DiscoveryTTL is not set
+const defaultDiscoveryTTL = time.Hour
+
+// ProviderMetadata is OpenID Connect discovery document of auth-server
+type ProviderMetadata struct {
+	Issuer                      string `json:"issuer"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	RevocationEndpoint          string `json:"revocation_endpoint"`
+	IntrospectionEndpoint       string `json:"introspection_endpoint"`
+	JWKSURI                     string `json:"jwks_uri"`
+	UserInfoEndpoint            string `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// discoveryCache hold last discovery document fetched from IssuerURL
+type discoveryCache struct {
+	meta      ProviderMetadata
+	fetchedAt time.Time
+}
+
+// Discover fetch discovery document from IssuerURL, ignoring cached one.
+// Endpoints not set explicitly on JwtAPI are taken from discovered document until DiscoveryTTL elapse.
+func (j *JwtAPI) Discover(ctx context.Context) (ProviderMetadata, error) {
+	if j.IssuerURL == "" {
+		return ProviderMetadata{}, fmt.Errorf("IssuerURL is not set")
+	}
+
+	wellknown := strings.TrimSuffix(j.IssuerURL, "/") + "/.well-known/openid-configuration"
+	j.logDebug("Discover", "Fetching discovery document from %s", wellknown)
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, wellknown, nil)
+	if err != nil {
+		return ProviderMetadata{}, err
+	}
+	r.Header.Set("Accept", "application/json")
+
+	resp, err := j.getClient().Do(r)
+	if err != nil {
+		return ProviderMetadata{}, fmt.Errorf("failed to fetch discovery document: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return ProviderMetadata{}, fmt.Errorf("failed to fetch discovery document (%d): %s", resp.StatusCode, body)
+	}
+
+	var meta ProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return meta, fmt.Errorf("failed to decode discovery document: %v", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(j.IssuerURL, "/") {
+		return meta, fmt.Errorf("discovery document issuer (%s) does not match IssuerURL (%s)", meta.Issuer, j.IssuerURL)
+	}
+	if meta.TokenEndpoint == "" {
+		return meta, fmt.Errorf("discovery document of %s has no token_endpoint", j.IssuerURL)
+	}
+	if meta.JWKSURI == "" {
+		return meta, fmt.Errorf("discovery document of %s has no jwks_uri", j.IssuerURL)
+	}
+
+	s := j.tokens()
+	s.mu.Lock()
+	s.discovery = &discoveryCache{meta: meta, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return meta, nil
+}
+
+// ensureDiscovery fetch discovery document when IssuerURL is set and cached document is missing or older than DiscoveryTTL
+func (j *JwtAPI) ensureDiscovery(ctx context.Context) error {
+	if j.IssuerURL == "" {
+		return nil
+	}
+
+	ttl := j.DiscoveryTTL
+	if ttl <= 0 {
+		ttl = defaultDiscoveryTTL
+	}
+	s := j.tokens()
+	s.mu.Lock()
+	fresh := s.discovery != nil && time.Since(s.discovery.fetchedAt) < ttl
+	s.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	_, err := j.Discover(ctx)
+	return err
+}
+
+// discovered returns cached discovery document, empty if not fetched yet
+func (j *JwtAPI) discovered() ProviderMetadata {
+	s := j.tokens()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.discovery == nil {
+		return ProviderMetadata{}
+	}
+	return s.discovery.meta
+}
+
+func (j *JwtAPI) GetRevocationURI() string {
+	if j.RevocationURI != "" {
+		return j.RevocationURI
+	}
+	return j.discovered().RevocationEndpoint
+}
+func (j *JwtAPI) GetIntrospectionURI() string {
+	if j.IntrospectionURI != "" {
+		return j.IntrospectionURI
+	}
+	return j.discovered().IntrospectionEndpoint
+}
+func (j *JwtAPI) GetJWKSURI() string {
+	if j.JWKSURI != "" {
+		return j.JWKSURI
+	}
+	return j.discovered().JWKSURI
+}
+func (j *JwtAPI) GetUserInfoURI() string {
+	if j.UserInfoURI != "" {
+		return j.UserInfoURI
+	}
+	return j.discovered().UserInfoEndpoint
+}
+func (j *JwtAPI) GetDeviceAuthURI() string {
+	if j.DeviceAuthURI != "" {
+		return j.DeviceAuthURI
+	}
+	return j.discovered().DeviceAuthorizationEndpoint
+}
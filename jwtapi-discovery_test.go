@@ -0,0 +1,77 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscovery(t *testing.T) {
+	fetches := 0
+	var meta ProviderMetadata
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(meta)
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "discovered-token"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	meta = ProviderMetadata{
+		Issuer:                srv.URL,
+		TokenEndpoint:         srv.URL + "/oauth/token",
+		RevocationEndpoint:    srv.URL + "/oauth/revoke",
+		IntrospectionEndpoint: srv.URL + "/oauth/introspect",
+		JWKSURI:               srv.URL + "/jwks",
+	}
+
+	j := &JwtAPI{IssuerURL: srv.URL + "/", DiscoveryTTL: 50 * time.Millisecond}
+	for i := 0; i < 2; i++ {
+		token, err := j.RequestTokenByCred()
+		if err != nil {
+			t.Fatalf("Get-Token error: %v", err)
+		}
+		if token.AccessToken != "discovered-token" {
+			t.Errorf("Expected: discovered-token,  Got: %s", token.AccessToken)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected cached discovery document, Got fetches: %d", fetches)
+	}
+	if j.GetRevocationURI() != meta.RevocationEndpoint || j.GetIntrospectionURI() != meta.IntrospectionEndpoint || j.GetJWKSURI() != meta.JWKSURI {
+		t.Errorf("Expected endpoints from discovery document, Got: %s, %s, %s", j.GetRevocationURI(), j.GetIntrospectionURI(), j.GetJWKSURI())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := j.RequestTokenByCred(); err != nil {
+		t.Fatalf("Get-Token error: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("Expected discovery document fetched again after TTL, Got fetches: %d", fetches)
+	}
+
+	tests := []struct {
+		edit func(m *ProviderMetadata)
+		err  string
+	}{
+		{func(m *ProviderMetadata) { m.TokenEndpoint = "" }, "no token_endpoint"},
+		{func(m *ProviderMetadata) { m.JWKSURI = "" }, "no jwks_uri"},
+		{func(m *ProviderMetadata) { m.Issuer = "https://evil.example.com" }, "does not match"},
+	}
+	good := meta
+	for _, tc := range tests {
+		meta = good
+		tc.edit(&meta)
+		_, err := (&JwtAPI{IssuerURL: srv.URL}).Discover(context.Background())
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error containing %q,  Got: %v", tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package apiclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dpopState hold key pair used to sign DPoP proofs and last nonce received from each server
+type dpopState struct {
+	mu     sync.Mutex
+	key    *ecdsa.PrivateKey
+	nonces map[string]string
+}
+
+type dpopJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type dpopHeader struct {
+	Typ string  `json:"typ"`
+	Alg string  `json:"alg"`
+	JWK dpopJWK `json:"jwk"`
+}
+
+type dpopClaims struct {
+	JTI   string `json:"jti"`
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	IAT   int64  `json:"iat"`
+	ATH   string `json:"ath,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+}
+
+func (j *JwtAPI) dpop() *dpopState {
+	s := j.tokens()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dpop == nil {
+		s.dpop = &dpopState{nonces: map[string]string{}}
+	}
+	return s.dpop
+}
+
+// signingKey returns key pair used for DPoP proofs, generating it on first use
+func (d *dpopState) signingKey() (*ecdsa.PrivateKey, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.key == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate DPoP key: %v", err)
+		}
+		d.key = key
+	}
+	return d.key, nil
+}
+
+func (d *dpopState) nonce(host string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nonces[host]
+}
+
+// setDPoPProof add signed DPoP proof header to r. accessToken is bound to proof through ath claim when not empty.
+func (j *JwtAPI) setDPoPProof(r *http.Request, accessToken string) error {
+	d := j.dpop()
+	key, err := d.signingKey()
+	if err != nil {
+		return err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return err
+	}
+
+	htu := *r.URL
+	htu.RawQuery = ""
+	htu.Fragment = ""
+
+	claims := dpopClaims{
+		JTI:   hex.EncodeToString(jti),
+		HTM:   r.Method,
+		HTU:   htu.String(),
+		IAT:   time.Now().Unix(),
+		Nonce: d.nonce(r.URL.Host),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims.ATH = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	header := dpopHeader{
+		Typ: "dpop+jwt",
+		Alg: "ES256",
+		JWK: dpopJWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(padBytes(key.X, 32)),
+			Y:   base64.RawURLEncoding.EncodeToString(padBytes(key.Y, 32)),
+		},
+	}
+
+	hb, _ := json.Marshal(header)
+	cb, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+
+	digest := sha256.Sum256([]byte(input))
+	sr, ss, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign DPoP proof: %v", err)
+	}
+	sig := append(padBytes(sr, 32), padBytes(ss, 32)...)
+
+	r.Header.Set("DPoP", input+"."+base64.RawURLEncoding.EncodeToString(sig))
+	return nil
+}
+
+// updateDPoPNonce save nonce sent by server in DPoP-Nonce header.
+// Returns true when server sent a nonce different from the one used in last proof.
+func (j *JwtAPI) updateDPoPNonce(resp *http.Response) bool {
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce == "" {
+		return false
+	}
+
+	d := j.dpop()
+	host := resp.Request.URL.Host
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.nonces[host] == nonce {
+		return false
+	}
+	d.nonces[host] = nonce
+	return true
+}
+
+// doTokenRequest send request to token endpoints. When UseDPoP is set, DPoP proof is added and
+// request is retried once if auth-server demand a nonce.
+func (j *JwtAPI) doTokenRequest(r *http.Request) (*http.Response, error) {
+	client := j.getClient()
+	if !j.UseDPoP {
+		return client.Do(r)
+	}
+
+	if err := j.setDPoPProof(r, ""); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return resp, err
+	}
+	if !j.updateDPoPNonce(resp) || resp.StatusCode == http.StatusOK || r.GetBody == nil {
+		return resp, nil
+	}
+
+	j.logDebug("doTokenRequest", "retrying with DPoP nonce, got status: %d", resp.StatusCode)
+	resp.Body.Close()
+	r2 := r.Clone(r.Context())
+	if r2.Body, err = r.GetBody(); err != nil {
+		return nil, err
+	}
+	if err := j.setDPoPProof(r2, ""); err != nil {
+		return nil, err
+	}
+	return client.Do(r2)
+}
+
+// padBytes returns big-endian bytes of n left padded with zeros to size
+func padBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	p := make([]byte, size)
+	copy(p[size-len(b):], b)
+	return p
+}
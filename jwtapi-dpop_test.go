@@ -0,0 +1,96 @@
+package apiclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// verifyDPoP check signature of DPoP proof in r and return its claims
+func verifyDPoP(r *http.Request) (dpopClaims, error) {
+	var claims dpopClaims
+	parts := strings.Split(r.Header.Get("DPoP"), ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("malformed proof")
+	}
+
+	var header dpopHeader
+	hb, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	cb, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if err := json.Unmarshal(hb, &header); err != nil {
+		return claims, err
+	}
+	if err := json.Unmarshal(cb, &claims); err != nil {
+		return claims, err
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(header.JWK.X)
+	y, _ := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+	pub := ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(&pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return claims, fmt.Errorf("invalid signature")
+	}
+	if claims.HTM != r.Method || !strings.HasSuffix(claims.HTU, r.URL.Path) {
+		return claims, fmt.Errorf("htm/htu mismatch")
+	}
+	return claims, nil
+}
+
+func TestDPoP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := verifyDPoP(r)
+		if err != nil {
+			t.Errorf("token proof: %v", err)
+		}
+		if claims.Nonce != "n1" {
+			w.Header().Set("DPoP-Nonce", "n1")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"use_dpop_nonce"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(Token{AccessToken: "dpop-token", TokenType: "DPoP"})
+	})
+	mux.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := verifyDPoP(r)
+		if err != nil {
+			t.Errorf("resource proof: %v", err)
+		}
+		sum := sha256.Sum256([]byte("dpop-token"))
+		if r.Header.Get("Authorization") != "DPoP dpop-token" || claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if claims.Nonce != "n2" {
+			w.Header().Set("DPoP-Nonce", "n2")
+			w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResult{Data: "protected-ok"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j := &JwtAPI{StructuredResponse: true, UseDPoP: true, ResourceAPIBaseURL: srv.URL, TokenURI: srv.URL + "/token"}
+	if _, err := j.RequestTokenByCred(); err != nil {
+		t.Fatalf("Get-Token error: %v", err)
+	}
+	res, err := j.Get("/protected")
+	if err != nil {
+		t.Fatalf("APIGet error: %v", err)
+	}
+	if res.Data != "protected-ok" {
+		t.Errorf("Expected: protected-ok,  Got: %s", res.Data)
+	}
+}
@@ -0,0 +1,147 @@
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token types used in TokenExchangeRequest (RFC 8693)
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangedTokenSkew is time before expiry after which cached exchanged token is not reused
+const exchangedTokenSkew = 30 * time.Second
+
+// TokenExchangeRequest is used to swap token of a subject for a new token (RFC 8693).
+// SubjectTokenType and ActorTokenType default to TokenTypeAccessToken.
+type TokenExchangeRequest struct {
+	SubjectToken     string
+	SubjectTokenType string
+	ActorToken       string
+	ActorTokenType   string
+	Audience         string
+	Scopes           string
+}
+
+func (tr TokenExchangeRequest) cacheKey() string {
+	return strings.Join([]string{tr.SubjectToken, tr.ActorToken, tr.Audience, strings.Join(parseScopes(tr.Scopes), " ")}, "\x00")
+}
+
+// ExchangeToken call TokenExchangeURI (TokenURI if not set) to swap subject token, optionally with actor token,
+// for new token with given audience and scopes. Client is authenticated with TokenRequestData.
+// Received token is cached per subject and reused by later calls until it expires.
+func (j *JwtAPI) ExchangeToken(ctx context.Context, treq TokenExchangeRequest) (Token, error) {
+	return j.exchangeToken(ctx, treq, Token{})
+}
+
+// Impersonate exchange subject token as ExchangeToken and returns JwtAPI which make calls through
+// normal Get, Post etc. methods with exchanged token. Token is exchanged again when it is rejected by API.
+func (j *JwtAPI) Impersonate(ctx context.Context, treq TokenExchangeRequest) (*JwtAPI, error) {
+	token, err := j.ExchangeToken(ctx, treq)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *j
+	c.TokenRequestData.Scopes = treq.Scopes
+	c.store = newTokenStore()
+	c.store.token = token
+	c.store.source = func(ctx context.Context, scopes string, stale Token) (Token, error) {
+		r := treq
+		if scopes != "" {
+			r.Scopes = scopes
+		}
+		return j.exchangeToken(ctx, r, stale)
+	}
+	return &c, nil
+}
+
+// exchangeToken returns cached token for treq unless it is expired or same as stale, else exchange subject token
+func (j *JwtAPI) exchangeToken(ctx context.Context, treq TokenExchangeRequest, stale Token) (Token, error) {
+	if treq.SubjectToken == "" {
+		return Token{}, fmt.Errorf("subject token is empty")
+	}
+
+	key := treq.cacheKey()
+	s := j.tokens()
+	s.mu.Lock()
+	cached, ok := s.exchanged[key]
+	s.mu.Unlock()
+	if ok && cached.usable(exchangedTokenSkew) && cached.AccessToken != stale.AccessToken {
+		return cached, nil
+	}
+
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return Token{}, err
+	}
+
+	creds, err := j.GetTokenRequestData().resolve(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", grantTypeTokenExchange)
+	form.Set("client_id", creds.ClientID)
+	if creds.ClientSecret != "" {
+		form.Set("client_secret", creds.ClientSecret)
+	}
+	form.Set("subject_token", treq.SubjectToken)
+	form.Set("subject_token_type", defaultTokenType(treq.SubjectTokenType))
+	if treq.ActorToken != "" {
+		form.Set("actor_token", treq.ActorToken)
+		form.Set("actor_token_type", defaultTokenType(treq.ActorTokenType))
+	}
+	if treq.Audience != "" {
+		form.Set("audience", treq.Audience)
+	}
+	if treq.Scopes != "" {
+		form.Set("scope", strings.Join(parseScopes(treq.Scopes), " "))
+	}
+
+	uri := j.TokenExchangeURI
+	if uri == "" {
+		uri = j.GetTokenURI()
+	}
+
+	j.logDebug("ExchangeToken", "Exchanging subject token for audience (%s)", treq.Audience)
+	resp, err := j.postForm(ctx, uri, form)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to exchange token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("failed to exchange token (%d): %v", resp.StatusCode, readOAuthError(resp))
+	}
+	token, err := j.decodeToken(resp.Body)
+	if err != nil {
+		return token, fmt.Errorf("failed to extract exchanged token: %v", err)
+	}
+
+	s.mu.Lock()
+	// drop expired tokens, cache would otherwise grow with every subject
+	for k, t := range s.exchanged {
+		if !t.usable(exchangedTokenSkew) {
+			delete(s.exchanged, k)
+		}
+	}
+	s.exchanged[key] = token
+	s.mu.Unlock()
+	return token, nil
+}
+
+func defaultTokenType(t string) string {
+	if t == "" {
+		return TokenTypeAccessToken
+	}
+	return t
+}
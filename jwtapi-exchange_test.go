@@ -0,0 +1,123 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImpersonate(t *testing.T) {
+	exchanges := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != grantTypeTokenExchange || r.FormValue("audience") != "orders" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(oauthError{Code: "invalid_request"})
+			return
+		}
+		exchanges++
+		json.NewEncoder(w).Encode(Token{AccessToken: fmt.Sprintf("%s-as-%s-%d", r.FormValue("actor_token"), r.FormValue("subject_token"), exchanges)})
+	})
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		token := extractToken(r)
+		if token == "svc-as-alice-1" {
+			// first exchanged token is treated as revoked
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResult{Data: token})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j := &JwtAPI{StructuredResponse: true, ResourceAPIBaseURL: srv.URL, TokenURI: srv.URL + "/token"}
+	treq := TokenExchangeRequest{SubjectToken: "alice", ActorToken: "svc", Audience: "orders"}
+
+	ctx := context.Background()
+	if _, err := j.ExchangeToken(ctx, treq); err != nil {
+		t.Fatalf("ExchangeToken error: %v", err)
+	}
+	alice, err := j.Impersonate(ctx, treq)
+	if err != nil {
+		t.Fatalf("Impersonate error: %v", err)
+	}
+	if exchanges != 1 {
+		t.Errorf("Expected cached exchange, Got exchanges: %d", exchanges)
+	}
+
+	res, err := alice.Get("/whoami")
+	if err != nil {
+		t.Fatalf("APIGet error: %v", err)
+	}
+	if exp := "svc-as-alice-2"; res.Data != exp {
+		t.Errorf("Expected: %s,  Got: %s", exp, res.Data)
+	}
+	if j.GetToken().AccessToken != "" {
+		t.Errorf("Expected parent token untouched, Got: %s", j.GetToken().AccessToken)
+	}
+}
+
+func TestExchangeCacheExpiry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "as-" + r.FormValue("subject_token"), ExpiresIn: "1"})
+	}))
+	defer srv.Close()
+
+	j := &JwtAPI{TokenURI: srv.URL}
+	for i := 0; i < 5; i++ {
+		if _, err := j.ExchangeToken(context.Background(), TokenExchangeRequest{SubjectToken: fmt.Sprint("user-", i)}); err != nil {
+			t.Fatalf("ExchangeToken error: %v", err)
+		}
+	}
+	if n := len(j.tokens().exchanged); n != 1 {
+		t.Errorf("Expected expired exchanged tokens dropped,  Got %d cached", n)
+	}
+}
+
+func TestImpersonateTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	ioutil.WriteFile(path, []byte("service-own"), 0600)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "as-" + r.FormValue("subject_token")})
+	})
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: extractToken(r)})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token", WithTokenSource(&FileTokenSource{Path: path}), WithStructuredResponse())
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	alice, err := j.Impersonate(context.Background(), TokenExchangeRequest{SubjectToken: "alice"})
+	if err != nil {
+		t.Fatalf("Impersonate error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		client *JwtAPI
+		token  string
+	}{{alice, "as-alice"}, {j, "service-own"}} {
+		res, err := tc.client.Get("/whoami")
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		if res.Data != tc.token {
+			t.Errorf("Expected token: %s,  Got: %s", tc.token, res.Data)
+		}
+	}
+}
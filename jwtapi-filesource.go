@@ -0,0 +1,102 @@
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFilePollInterval is used when FileTokenSource.PollInterval is not set
+const defaultFilePollInterval = 30 * time.Second
+
+// FileTokenSource is TokenSource reading bearer token from file, such as token projected into
+// Kubernetes pod volume. File is read again when it changes, which is checked on every use and
+// by Watch in background, and whenever API reject the token.
+type FileTokenSource struct {
+	Path string
+	// PollInterval is how often Watch check file for changes, default 30 seconds
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	token   Token
+	modTime time.Time
+	size    int64
+}
+
+// Token returns token read from file, reloading it if file changed since last read
+func (f *FileTokenSource) Token(ctx context.Context) (Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.reload(false); err != nil {
+		return Token{}, err
+	}
+	return f.token, nil
+}
+
+// Watch poll file every PollInterval and reload token when it change, until ctx is done
+func (f *FileTokenSource) Watch(ctx context.Context) {
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = defaultFilePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			f.reload(false)
+			f.mu.Unlock()
+		}
+	}
+}
+
+// String print FileTokenSource without token read from file
+func (f *FileTokenSource) String() string {
+	return fmt.Sprintf("{Path:%s PollInterval:%v}", f.Path, f.PollInterval)
+}
+
+// GoString print FileTokenSource without token read from file
+func (f *FileTokenSource) GoString() string {
+	return fmt.Sprintf("&apiclient.FileTokenSource{Path:%q, PollInterval:%d}", f.Path, f.PollInterval)
+}
+
+func (f *FileTokenSource) invalidate(stale Token) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token.AccessToken == stale.AccessToken {
+		// token was rejected, file may have been rotated within same second and size
+		f.reload(true)
+	}
+}
+
+// reload read file if forced or its modification time or size changed. Caller must hold f.mu.
+func (f *FileTokenSource) reload(force bool) (bool, error) {
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read token file: %v", err)
+	}
+	if !force && f.token.AccessToken != "" && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read token file: %v", err)
+	}
+	access := strings.TrimSpace(string(data))
+	if access == "" {
+		return false, fmt.Errorf("token file %s is empty", f.Path)
+	}
+
+	f.token = Token{TokenType: "Bearer", AccessToken: access}
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	revoked, rejected := "", 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := extractToken(r)
+		if token == revoked {
+			rejected++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResult{Data: token})
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(dir, "token")
+	mtime := time.Now().Add(-time.Hour)
+	j := &JwtAPI{StructuredResponse: true, ResourceAPIBaseURL: srv.URL, TokenSource: &FileTokenSource{Path: path}}
+
+	tests := []struct {
+		token   string
+		touch   bool
+		revoke  string
+		rejects int
+	}{
+		{"projected-0", false, "", 0},
+		// rotated with same size and time, noticed only when API reject cached token
+		{"projected-1", false, "projected-0", 1},
+		// rotated with new time, noticed before request
+		{"projected-2", true, "projected-1", 0},
+	}
+	for _, tc := range tests {
+		if tc.touch {
+			mtime = mtime.Add(time.Minute)
+		}
+		ioutil.WriteFile(path, []byte(tc.token+"\n"), 0600)
+		os.Chtimes(path, mtime, mtime)
+		revoked, rejected = tc.revoke, 0
+
+		res, err := j.Get("/protected")
+		if err != nil {
+			t.Fatalf("APIGet error: %v", err)
+		}
+		if res.Data != tc.token || rejected != tc.rejects {
+			t.Errorf("Expected: %s rejected %d times,  Got: %s rejected %d times", tc.token, tc.rejects, res.Data, rejected)
+		}
+	}
+	if out := fmt.Sprintf("%v %+v %#v", j.TokenSource, j.TokenSource, j.TokenSource); strings.Contains(out, "projected") || !strings.Contains(out, path) {
+		t.Errorf("Expected source without cached token,  Got: %s", out)
+	}
+}
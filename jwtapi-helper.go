@@ -2,7 +2,7 @@ package apiclient
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -19,10 +19,28 @@ func (j *JwtAPI) SetLogWriter(w io.Writer) {
 	j.logger = l
 }
 
+// Login get token by login with TokenRequestData (or from TokenSource) and set it to JwtAPI instance for subsequent calls.
+// Calling it is optional, token is acquired on first request if JwtAPI does not have one.
+func (j *JwtAPI) Login(ctx context.Context) error {
+	s := j.tokens()
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+
+	if j.hasTokenSource() {
+		t, err := j.acquireToken(ctx, "", Token{})
+		if err != nil {
+			return err
+		}
+		j.setToken(t)
+		return nil
+	}
+	return j.requestTokenByLogin(ctx)
+}
+
 // RequestTokenByCred call Token endpoint to get new token by passing TokenRequest data.
 // It set token to JwtAPI instance for subsequent calls through same instance.
 func (j *JwtAPI) RequestTokenByCred() (Token, error) {
-	err := j.requestTokenByLogin()
+	err := j.requestTokenByLogin(context.Background())
 	if err != nil {
 		return Token{}, err
 	}
@@ -33,7 +51,7 @@ func (j *JwtAPI) RequestTokenByCred() (Token, error) {
 // RequestTokenByRefreshToken call Token endpoint to get new token by passing existing refresh-token.
 // It set token to JwtAPI instance for subsequent calls through same instance.
 func (j *JwtAPI) RequestTokenByRefreshToken(rtoken string) (Token, error) {
-	err := j.requestTokenByRefreshToken(rtoken)
+	err := j.requestTokenByRefreshToken(context.Background(), rtoken)
 	if err != nil {
 		return Token{}, err
 	}
@@ -42,15 +60,27 @@ func (j *JwtAPI) RequestTokenByRefreshToken(rtoken string) (Token, error) {
 	return j.GetToken(), nil
 }
 
-// Get - make HTTP GET request to given api path and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// joinURL returns URL for apipath under ResourceAPIBaseURL, rejecting absolute apipath on other host
+// so token is not sent there
+func (j *JwtAPI) joinURL(apipath string) (string, error) {
+	return joinAuthURL(j.GetBaseURL(), apipath)
+}
+
+// Get - make HTTP GET request to given api path and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
+// Token is sent with request, so absolute apipath on other host than ResourceAPIBaseURL is rejected; call GetURL
+// to send token to another host on purpose.
 func (j *JwtAPI) Get(apipath string) (APIResult, error) {
-	return j.GetURL(j.GetBaseURL() + apipath)
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.GetURL(apiurl)
 }
 
 // GetURL - call given apiurl with GET method, auto inject Authorization Header, returns RawResult{}.
 func (j *JwtAPI) GetURL(apiurl string) (APIResult, error) {
 	var res APIResult
-	resp, err := j.makeRequest(http.MethodGet, apiurl, nil)
+	resp, err := j.makeRequest(context.Background(), http.MethodGet, apiurl, nil)
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -64,9 +94,14 @@ func (j *JwtAPI) GetURL(apiurl string) (APIResult, error) {
 	return getRawResultJWT(resp)
 }
 
-// Post - make HTTP POST request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Post - make HTTP POST request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
+// As with Get, absolute apipath must be on host of ResourceAPIBaseURL.
 func (j *JwtAPI) Post(apipath string, postdataJSON []byte) (APIResult, error) {
-	return j.PostURL(j.GetBaseURL()+apipath, postdataJSON)
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.PostURL(apiurl, postdataJSON)
 }
 
 // PostURL - call given apiurl with POST method and pass data, auto inject Authorization Header, returns RawResult{}.
@@ -76,7 +111,7 @@ func (j *JwtAPI) PostURL(apiurl string, postdataJSON []byte) (APIResult, error)
 		return res, fmt.Errorf("postdata is nil")
 	}
 
-	resp, err := j.makeRequest(http.MethodPost, apiurl, bytes.NewBuffer(postdataJSON))
+	resp, err := j.makeRequest(context.Background(), http.MethodPost, apiurl, bytes.NewBuffer(postdataJSON))
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -90,9 +125,13 @@ func (j *JwtAPI) PostURL(apiurl string, postdataJSON []byte) (APIResult, error)
 	return getRawResultJWT(resp)
 }
 
-// Put - make HTTP PUT request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Put - make HTTP PUT request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (j *JwtAPI) Put(apipath string, putdataJSON []byte) (APIResult, error) {
-	return j.PutURL(j.GetBaseURL()+apipath, putdataJSON)
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.PutURL(apiurl, putdataJSON)
 }
 
 // PutURL - call given apiurl with PUT method and pass data, auto inject Authorization Header, returns RawResult{}.
@@ -102,7 +141,7 @@ func (j *JwtAPI) PutURL(apiurl string, putdataJSON []byte) (APIResult, error) {
 		return res, fmt.Errorf("putdata is nil")
 	}
 
-	resp, err := j.makeRequest(http.MethodPut, apiurl, bytes.NewBuffer(putdataJSON))
+	resp, err := j.makeRequest(context.Background(), http.MethodPut, apiurl, bytes.NewBuffer(putdataJSON))
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -116,9 +155,13 @@ func (j *JwtAPI) PutURL(apiurl string, putdataJSON []byte) (APIResult, error) {
 	return getRawResultJWT(resp)
 }
 
-// Post - make HTTP PATCH request to given api path, post JSON data and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Post - make HTTP PATCH request to given api path, post JSON data and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (j *JwtAPI) Patch(apipath string, patchdataJSON []byte) (APIResult, error) {
-	return j.PatchURL(j.GetBaseURL()+apipath, patchdataJSON)
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.PatchURL(apiurl, patchdataJSON)
 }
 
 // PostURL - call given apiurl with PATCH method and pass data, auto inject Authorization Header, returns RawResult{}.
@@ -128,7 +171,7 @@ func (j *JwtAPI) PatchURL(apiurl string, patchdataJSON []byte) (APIResult, error
 		return res, fmt.Errorf("patchdata is nil")
 	}
 
-	resp, err := j.makeRequest(http.MethodPatch, apiurl, bytes.NewBuffer(patchdataJSON))
+	resp, err := j.makeRequest(context.Background(), http.MethodPatch, apiurl, bytes.NewBuffer(patchdataJSON))
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -142,15 +185,19 @@ func (j *JwtAPI) PatchURL(apiurl string, patchdataJSON []byte) (APIResult, error
 	return getRawResultJWT(resp)
 }
 
-// Delete - make HTTP DELETE request to given api path and return APIResult{}. ResourceAPIBaseURL will be prepended.
+// Delete - make HTTP DELETE request to given api path and return APIResult{}. apipath is joined to ResourceAPIBaseURL by JoinURL.
 func (j *JwtAPI) Delete(apipath string) (APIResult, error) {
-	return j.DeleteURL(j.GetBaseURL() + apipath)
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return APIResult{}, err
+	}
+	return j.DeleteURL(apiurl)
 }
 
 // DeleteURL - call given apiurl with DELETE method, auto inject Authorization Header, returns RawResult{}.
 func (j *JwtAPI) DeleteURL(apiurl string) (APIResult, error) {
 	var res APIResult
-	resp, err := j.makeRequest(http.MethodGet, apiurl, nil)
+	resp, err := j.makeRequest(context.Background(), http.MethodGet, apiurl, nil)
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -185,7 +232,7 @@ func getAPIResultJWT(resp *http.Response) (APIResult, error) {
 		return handleNotOK(resp), nil
 	}
 
-	json.NewDecoder(resp.Body).Decode(&res)
+	apiResultCodec(resp).Decode(resp.Body, &res)
 	res.ErrValid = true
 	return res, nil
 }
@@ -0,0 +1,132 @@
+package apiclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Introspection is result of token introspection (RFC 7662)
+type Introspection struct {
+	Active    bool
+	Scopes    []string
+	Subject   string
+	ClientID  string
+	Username  string
+	TokenType string
+	Issuer    string
+	Expiry    time.Time
+	IssuedAt  time.Time
+}
+
+type introspectionEntry struct {
+	result Introspection
+	until  time.Time
+}
+
+// Introspect ask IntrospectionURI (or discovered endpoint) whether token is active, authenticating with
+// ClientID and ClientSecret of TokenRequestData. Results are cached for IntrospectionCacheTTL when set,
+// but never beyond expiry of token.
+func (j *JwtAPI) Introspect(ctx context.Context, token string) (Introspection, error) {
+	var res Introspection
+	if token == "" {
+		return res, fmt.Errorf("token is empty")
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	s := j.tokens()
+	if j.IntrospectionCacheTTL > 0 {
+		s.mu.Lock()
+		e, ok := s.introspected[key]
+		s.mu.Unlock()
+		if ok && time.Now().Before(e.until) {
+			return e.result, nil
+		}
+	}
+
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return res, err
+	}
+	uri := j.GetIntrospectionURI()
+	if uri == "" {
+		return res, fmt.Errorf("IntrospectionURI is not set")
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return res, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	creds, err := j.GetTokenRequestData().resolve(ctx)
+	if err != nil {
+		return res, err
+	}
+	r.SetBasicAuth(url.QueryEscape(creds.ClientID), url.QueryEscape(creds.ClientSecret))
+
+	resp, err := j.doTokenRequest(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to introspect token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("failed to introspect token (%d): %v", resp.StatusCode, readOAuthError(resp))
+	}
+
+	var raw struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope"`
+		Sub       string `json:"sub"`
+		ClientID  string `json:"client_id"`
+		Username  string `json:"username"`
+		TokenType string `json:"token_type"`
+		Iss       string `json:"iss"`
+		Exp       int64  `json:"exp"`
+		Iat       int64  `json:"iat"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return res, fmt.Errorf("failed to decode introspection response: %v", err)
+	}
+	res = Introspection{
+		Active:    raw.Active,
+		Scopes:    strings.Fields(raw.Scope),
+		Subject:   raw.Sub,
+		ClientID:  raw.ClientID,
+		Username:  raw.Username,
+		TokenType: raw.TokenType,
+		Issuer:    raw.Iss,
+	}
+	if raw.Exp > 0 {
+		res.Expiry = time.Unix(raw.Exp, 0)
+	}
+	if raw.Iat > 0 {
+		res.IssuedAt = time.Unix(raw.Iat, 0)
+	}
+
+	if j.IntrospectionCacheTTL > 0 {
+		now := time.Now()
+		until := now.Add(j.IntrospectionCacheTTL)
+		if !res.Expiry.IsZero() && res.Expiry.Before(until) {
+			until = res.Expiry
+		}
+		s.mu.Lock()
+		for k, e := range s.introspected {
+			if now.After(e.until) {
+				delete(s.introspected, k)
+			}
+		}
+		s.introspected[key] = introspectionEntry{result: res, until: until}
+		s.mu.Unlock()
+	}
+	return res, nil
+}
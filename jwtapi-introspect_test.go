@@ -0,0 +1,51 @@
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	calls := 0
+	exp := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if user, pwd, ok := r.BasicAuth(); !ok || user != "cli" || pwd != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("token") != "opaque-1" {
+			fmt.Fprint(w, `{"active":false}`)
+			return
+		}
+		fmt.Fprintf(w, `{"active":true,"scope":"orders:read user","sub":"alice","exp":%d}`, exp)
+	}))
+	defer srv.Close()
+
+	j := &JwtAPI{IntrospectionURI: srv.URL, IntrospectionCacheTTL: time.Minute}
+	j.TokenRequestData.ClientID = "cli"
+	j.TokenRequestData.ClientSecret = "secret"
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		res, err := j.Introspect(ctx, "opaque-1")
+		if err != nil {
+			t.Fatalf("Introspect error: %v", err)
+		}
+		if !res.Active || res.Subject != "alice" || len(res.Scopes) != 2 || res.Expiry.Unix() != exp {
+			t.Errorf("Expected active token of alice,  Got: %+v", res)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected cached introspection, Got calls: %d", calls)
+	}
+
+	res, err := j.Introspect(ctx, "opaque-2")
+	if err != nil || res.Active {
+		t.Errorf("Expected inactive token,  Got: %+v (%v)", res, err)
+	}
+}
@@ -0,0 +1,415 @@
+package apiclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idTokenLeeway is clock skew allowed while checking exp of ID token
+const idTokenLeeway = time.Minute
+
+// jwksRefetchInterval is minimum time between JWKS fetches for unknown key-ids, so tokens with
+// forged kid can't make client flood the JWKS endpoint
+const jwksRefetchInterval = time.Minute
+
+// IDTokenClaims hold validated claims of OpenID Connect ID token
+type IDTokenClaims struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Nonce    string
+	Expiry   time.Time
+	IssuedAt time.Time
+	// Claims hold all claims of ID token including the ones above
+	Claims map[string]interface{}
+}
+
+// UserInfo is response of OpenID Connect userinfo endpoint
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Claims hold all returned claims including the ones above
+	Claims map[string]interface{} `json:"-"`
+}
+
+// jwksCache hold public keys fetched from JWKS endpoint by key-id
+type jwksCache struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// IDTokenClaims returns validated claims of ID token received with current token
+func (j *JwtAPI) IDTokenClaims(ctx context.Context) (IDTokenClaims, error) {
+	raw := j.GetToken().IDToken
+	if raw == "" {
+		return IDTokenClaims{}, fmt.Errorf("token has no id_token")
+	}
+	return j.VerifyIDToken(ctx, raw, "")
+}
+
+// VerifyIDToken validate signature of raw ID token through JWKS, and its iss, aud, exp claims.
+// nonce is checked only when not empty.
+func (j *JwtAPI) VerifyIDToken(ctx context.Context, raw, nonce string) (IDTokenClaims, error) {
+	var idt IDTokenClaims
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return idt, fmt.Errorf("malformed id_token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return idt, fmt.Errorf("malformed id_token header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return idt, fmt.Errorf("malformed id_token signature: %v", err)
+	}
+
+	key, err := j.jwksKey(ctx, header.Kid)
+	if err != nil {
+		return idt, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return idt, err
+	}
+
+	if err := decodeJWTPart(parts[1], &idt.Claims); err != nil {
+		return idt, fmt.Errorf("malformed id_token claims: %v", err)
+	}
+	idt.Issuer, _ = idt.Claims["iss"].(string)
+	idt.Subject, _ = idt.Claims["sub"].(string)
+	idt.Nonce, _ = idt.Claims["nonce"].(string)
+	idt.Expiry = claimTime(idt.Claims["exp"])
+	idt.IssuedAt = claimTime(idt.Claims["iat"])
+	switch aud := idt.Claims["aud"].(type) {
+	case string:
+		idt.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				idt.Audience = append(idt.Audience, s)
+			}
+		}
+	}
+
+	issuer := j.IssuerURL
+	if issuer == "" {
+		issuer = j.discovered().Issuer
+	}
+	if issuer == "" {
+		return idt, fmt.Errorf("IssuerURL is not set, can not validate id_token issuer")
+	}
+	if strings.TrimSuffix(idt.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return idt, fmt.Errorf("id_token issuer (%s) does not match (%s)", idt.Issuer, issuer)
+	}
+
+	clientID := j.GetTokenRequestData().ClientID
+	validAud := false
+	for _, a := range idt.Audience {
+		if a == clientID {
+			validAud = true
+		}
+	}
+	if !validAud {
+		return idt, fmt.Errorf("id_token audience (%s) does not include client (%s)", strings.Join(idt.Audience, ","), clientID)
+	}
+	if azp, ok := idt.Claims["azp"].(string); ok && len(idt.Audience) > 1 && azp != clientID {
+		return idt, fmt.Errorf("id_token authorized party (%s) is not client (%s)", azp, clientID)
+	}
+
+	if idt.Expiry.IsZero() || time.Now().Add(-idTokenLeeway).After(idt.Expiry) {
+		return idt, fmt.Errorf("id_token is expired")
+	}
+	if nonce != "" && idt.Nonce != nonce {
+		return idt, fmt.Errorf("id_token nonce does not match")
+	}
+	return idt, nil
+}
+
+// UserInfo call userinfo endpoint with current access token
+func (j *JwtAPI) UserInfo(ctx context.Context) (UserInfo, error) {
+	var ui UserInfo
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return ui, err
+	}
+	uri := j.GetUserInfoURI()
+	if uri == "" {
+		return ui, fmt.Errorf("UserInfoURI is not set")
+	}
+
+	resp, err := j.makeRequest(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return ui, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ui, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ui, fmt.Errorf("failed to get userinfo (%d): %s", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, &ui); err != nil {
+		return ui, fmt.Errorf("failed to decode userinfo: %v", err)
+	}
+	json.Unmarshal(body, &ui.Claims)
+
+	// sub of userinfo must match sub of ID token, if we have one
+	if raw := j.GetToken().IDToken; raw != "" {
+		if idt, err := j.VerifyIDToken(ctx, raw, ""); err == nil && idt.Subject != ui.Subject {
+			return ui, fmt.Errorf("userinfo subject (%s) does not match id_token subject (%s)", ui.Subject, idt.Subject)
+		}
+	}
+	return ui, nil
+}
+
+// installToken set token received by login or device grant to JwtAPI, validating its ID token
+// first when ValidateIDToken is set
+func (j *JwtAPI) installToken(ctx context.Context, token Token, nonce string) error {
+	if j.ValidateIDToken {
+		if token.IDToken == "" {
+			return fmt.Errorf("token response has no id_token")
+		}
+		if _, err := j.VerifyIDToken(ctx, token.IDToken, nonce); err != nil {
+			return err
+		}
+	}
+	j.setToken(token)
+	return nil
+}
+
+// installRefreshedToken set token received for refresh-token to JwtAPI. Refresh responses may omit
+// id_token (OpenID Connect Core 12.2), so when ValidateIDToken is set id_token is validated only when
+// present, and must be of same subject as previous one. Previous id_token is kept when it is omitted.
+func (j *JwtAPI) installRefreshedToken(ctx context.Context, token Token) error {
+	if !j.ValidateIDToken {
+		j.setToken(token)
+		return nil
+	}
+	prev := j.GetToken()
+	if token.IDToken == "" {
+		token.IDToken = prev.IDToken
+		j.setToken(token)
+		return nil
+	}
+	idt, err := j.VerifyIDToken(ctx, token.IDToken, "")
+	if err != nil {
+		return err
+	}
+	if sub := idTokenSubject(prev.IDToken); sub != "" && sub != idt.Subject {
+		return fmt.Errorf("refreshed id_token subject (%s) does not match previous subject (%s)", idt.Subject, sub)
+	}
+	j.setToken(token)
+	return nil
+}
+
+// idTokenSubject returns sub claim of raw id_token without verifying it, empty if it can't be read
+func idTokenSubject(raw string) string {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if decodeJWTPart(parts[1], &claims) != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+// jwksKey returns public key for kid, fetching JWKS again when kid is not known,
+// but not more often than jwksRefetchInterval
+func (j *JwtAPI) jwksKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s := j.tokens()
+	s.mu.Lock()
+	if s.jwks == nil {
+		s.jwks = &jwksCache{}
+	}
+	c := s.jwks
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if !c.fetched.IsZero() && time.Since(c.fetched) < jwksRefetchInterval {
+		return nil, fmt.Errorf("no key found in JWKS for kid (%s)", kid)
+	}
+
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return nil, err
+	}
+	uri := j.GetJWKSURI()
+	if uri == "" {
+		return nil, fmt.Errorf("JWKSURI is not set")
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.getClient().Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS (%d)", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %v", err)
+	}
+	c.keys = map[string]crypto.PublicKey{}
+	c.fetched = time.Now()
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil {
+			c.keys[k.Kid] = key
+		} else {
+			j.logDebug("jwksKey", "skipping key (%s): %v", k.Kid, err)
+		}
+	}
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key found in JWKS for kid (%s)", kid)
+	}
+	return key, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// esCurve is curve required for key of each ECDSA algorithm
+var esCurve = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// verifyJWTSignature verify JWS signature of signing input with given algorithm and key
+func verifyJWTSignature(alg string, key crypto.PublicKey, input string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported id_token alg %s", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported id_token alg %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+				return fmt.Errorf("invalid id_token signature")
+			}
+			return nil
+		}
+		if strings.HasPrefix(alg, "PS") {
+			if err := rsa.VerifyPSS(pub, hash, digest, sig, nil); err != nil {
+				return fmt.Errorf("invalid id_token signature")
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if strings.HasPrefix(alg, "ES") && len(sig)%2 == 0 {
+			if pub.Curve.Params().Name != esCurve[alg] {
+				return fmt.Errorf("id_token alg %s does not match curve %s of key", alg, pub.Curve.Params().Name)
+			}
+			half := len(sig) / 2
+			if !ecdsa.Verify(pub, digest, new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])) {
+				return fmt.Errorf("invalid id_token signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("id_token alg %s does not match key type", alg)
+}
+
+func decodeJWTPart(part string, dest interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dest)
+}
+
+func claimTime(v interface{}) time.Time {
+	if f, ok := v.(float64); ok {
+		return time.Unix(int64(f), 0)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,196 @@
+package apiclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signTestIDToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	hb, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	cb, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign error: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyJWTSignatureCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key error: %v", err)
+	}
+	input := "header.claims"
+	pad := func(n *big.Int) []byte {
+		b := n.Bytes()
+		return append(make([]byte, 32-len(b)), b...)
+	}
+	hashes := map[string]crypto.Hash{"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512}
+	for alg, hash := range hashes {
+		h := hash.New()
+		h.Write([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		if err != nil {
+			t.Fatalf("sign error: %v", err)
+		}
+		sig := append(pad(r), pad(s)...)
+
+		err = verifyJWTSignature(alg, &key.PublicKey, input, sig)
+		if alg == "ES256" && err != nil {
+			t.Errorf("%s: verify error: %v", alg, err)
+		}
+		if alg != "ES256" && (err == nil || !strings.Contains(err.Error(), "curve")) {
+			t.Errorf("%s: Expected error for P-256 key,  Got: %v", alg, err)
+		}
+	}
+}
+
+func TestIDTokenValidation(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("key error: %v", err)
+	}
+
+	var srv *httptest.Server
+	var jwksFetches int32
+	idToken, refreshIDToken := "", ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProviderMetadata{Issuer: srv.URL, TokenEndpoint: srv.URL + "/token", JWKSURI: srv.URL + "/jwks", UserInfoEndpoint: srv.URL + "/userinfo"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&jwksFetches, 1)
+		jwk := jsonWebKey{Kid: "k1", Kty: "RSA",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "oidc-token", IDToken: idToken})
+	})
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "refreshed", RefreshToken: "r2", IDToken: refreshIDToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if extractToken(r) != "oidc-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub":"alice","email":"alice@example.com","tenant":"t1"}`))
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"iss": srv.URL, "sub": "alice", "aud": "cli", "nonce": "n-1", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	tests := []struct {
+		name string
+		edit func(c map[string]interface{})
+		err  string
+	}{
+		{"valid", func(c map[string]interface{}) {}, ""},
+		{"audience", func(c map[string]interface{}) { c["aud"] = []string{"other"} }, "audience"},
+		{"issuer", func(c map[string]interface{}) { c["iss"] = "https://evil" }, "issuer"},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "expired"},
+		{"nonce", func(c map[string]interface{}) { c["nonce"] = "n-2" }, "nonce"},
+	}
+	for _, tc := range tests {
+		claims := valid()
+		tc.edit(claims)
+		idToken = signTestIDToken(t, key, claims)
+
+		j := &JwtAPI{IssuerURL: srv.URL, ValidateIDToken: true, IDTokenNonce: "n-1"}
+		j.TokenRequestData.ClientID = "cli"
+		_, err := j.RequestTokenByCred()
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: Get-Token error: %v", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: Expected error containing %q,  Got: %v", tc.name, tc.err, err)
+		}
+	}
+
+	idToken = signTestIDToken(t, key, valid())
+	j := &JwtAPI{IssuerURL: srv.URL}
+	j.TokenRequestData.ClientID = "cli"
+	if _, err := j.RequestTokenByCred(); err != nil {
+		t.Fatalf("Get-Token error: %v", err)
+	}
+	idt, err := j.IDTokenClaims(context.Background())
+	if err != nil || idt.Subject != "alice" {
+		t.Errorf("Expected subject alice,  Got: %s (%v)", idt.Subject, err)
+	}
+	ui, err := j.UserInfo(context.Background())
+	if err != nil {
+		t.Fatalf("UserInfo error: %v", err)
+	}
+	if ui.Email != "alice@example.com" || ui.Claims["tenant"] != "t1" {
+		t.Errorf("Expected userinfo of alice,  Got: %+v", ui)
+	}
+
+	// id_token is optional in refresh response, but must be of same subject when present
+	bob := valid()
+	bob["sub"] = "bob"
+	refreshTests := []struct {
+		name    string
+		idToken string
+		err     string
+	}{
+		{"no id_token", "", ""},
+		{"same subject", signTestIDToken(t, key, valid()), ""},
+		{"other subject", signTestIDToken(t, key, bob), "does not match"},
+	}
+	for _, tc := range refreshTests {
+		refreshIDToken = tc.idToken
+		j := &JwtAPI{IssuerURL: srv.URL, RefreshTokenURI: srv.URL + "/refresh", ValidateIDToken: true, IDTokenNonce: "n-1"}
+		j.TokenRequestData.ClientID = "cli"
+		if _, err := j.RequestTokenByCred(); err != nil {
+			t.Fatalf("%s: Get-Token error: %v", tc.name, err)
+		}
+		token, err := j.RequestTokenByRefreshToken("r1")
+		if tc.err == "" && (err != nil || token.AccessToken != "refreshed" || token.IDToken == "") {
+			t.Errorf("%s: Expected refreshed token with id_token,  Got: %+v (%v)", tc.name, token, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: Expected error containing %q,  Got: %v", tc.name, tc.err, err)
+		}
+	}
+
+	// unknown kid fetch JWKS again only after jwksRefetchInterval
+	j = &JwtAPI{IssuerURL: srv.URL}
+	ctx := context.Background()
+	atomic.StoreInt32(&jwksFetches, 0)
+	if _, err := j.jwksKey(ctx, "k1"); err != nil {
+		t.Fatalf("jwksKey error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := j.jwksKey(ctx, "forged"); err == nil {
+			t.Errorf("Expected error for unknown kid")
+		}
+	}
+	if n := atomic.LoadInt32(&jwksFetches); n != 1 {
+		t.Errorf("Expected single JWKS fetch for unknown kids,  Got: %d", n)
+	}
+	j.tokens().jwks.fetched = time.Now().Add(-jwksRefetchInterval)
+	j.jwksKey(ctx, "forged")
+	if n := atomic.LoadInt32(&jwksFetches); n != 2 {
+		t.Errorf("Expected JWKS fetched again after interval,  Got: %d fetches", n)
+	}
+}
@@ -0,0 +1,128 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RefreshPolicy decide how JwtAPI behave when refresh-token could not be exchanged for new token
+type RefreshPolicy int
+
+const (
+	// RefreshFallbackLogin request new token by login with TokenRequestData. It is the default policy.
+	RefreshFallbackLogin RefreshPolicy = iota
+	// RefreshFailFast return refresh error to caller without any further attempt
+	RefreshFailFast
+	// RefreshRetryBackoff retry refresh with exponential backoff when auth-server is unreachable or
+	// return 5xx status, then return last error to caller
+	RefreshRetryBackoff
+)
+
+const (
+	defaultRefreshRetries = 3
+	defaultRefreshBackoff = 500 * time.Millisecond
+)
+
+func (p RefreshPolicy) String() string {
+	switch p {
+	case RefreshFallbackLogin:
+		return "fallback-login"
+	case RefreshFailFast:
+		return "fail-fast"
+	case RefreshRetryBackoff:
+		return "retry-backoff"
+	}
+	return "unknown"
+}
+
+// fetchTokenByRefreshToken get new token by refresh-token and return it without storing it.
+// Failure is handled as per RefreshPolicy, treq is used when policy fallback to login.
+func (j *JwtAPI) fetchTokenByRefreshToken(ctx context.Context, rtoken string, treq TokenRequest) (Token, error) {
+	token, status, err := j.exchangeRefreshToken(ctx, rtoken)
+	if err == nil {
+		return token, nil
+	}
+
+	switch j.RefreshPolicy {
+	case RefreshFailFast:
+		return token, err
+
+	case RefreshRetryBackoff:
+		retries := j.RefreshRetries
+		if retries <= 0 {
+			retries = defaultRefreshRetries
+		}
+		backoff := j.RefreshBackoff
+		if backoff <= 0 {
+			backoff = defaultRefreshBackoff
+		}
+		for i := 0; i < retries && retriableRefresh(status); i++ {
+			j.logDebug("RequestTokenByRefreshToken", "retry[%d] refresh after %v: %v", i+1, backoff, err)
+			select {
+			case <-ctx.Done():
+				return token, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+
+			token, status, err = j.exchangeRefreshToken(ctx, rtoken)
+			if err == nil {
+				return token, nil
+			}
+		}
+		return token, err
+	}
+
+	// Try to get a fresh AccessToken by login
+	j.logDebug("RequestTokenByRefreshToken", "falling back to login: %v", err)
+	return j.fetchTokenByLogin(ctx, treq)
+}
+
+// retriableRefresh tells if refresh attempt that ended with given status is worth retrying
+func retriableRefresh(status int) bool {
+	return status == 0 || status >= http.StatusInternalServerError
+}
+
+// renewToken get new token in place of stale one identified by scope-key returned from tokenFor.
+// Concurrent requests failing with the same stale token trigger a single renewal.
+func (j *JwtAPI) renewToken(ctx context.Context, key string, stale Token) error {
+	s := j.tokens()
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+
+	if cur := s.lookup(key); cur.AccessToken != stale.AccessToken {
+		// already renewed by another request
+		return nil
+	}
+
+	var t Token
+	var err error
+	switch {
+	case j.hasTokenSource():
+		t, err = j.acquireToken(ctx, key, stale)
+	case key == "" && stale.RefreshToken == "":
+		// nothing to refresh, e.g. no token acquired yet
+		return j.requestTokenByLogin(ctx)
+	case key == "":
+		return j.requestTokenByRefreshToken(ctx, stale.RefreshToken)
+	case stale.RefreshToken == "":
+		t, err = j.acquireToken(ctx, key, stale)
+	default:
+		treq := j.GetTokenRequestData()
+		treq.Scopes = key
+		t, err = j.fetchTokenByRefreshToken(ctx, stale.RefreshToken, treq)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if key == "" {
+		s.token = t
+	} else {
+		s.scoped[key] = t
+	}
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,92 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshPolicy(t *testing.T) {
+	refreshes, logins := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		if logins > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Token{AccessToken: "expired", RefreshToken: "r1"})
+	})
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/protected-exp", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		policy    RefreshPolicy
+		refreshes int
+		logins    int
+	}{
+		{RefreshFallbackLogin, 1, 2},
+		{RefreshFailFast, 1, 1},
+		{RefreshRetryBackoff, 3, 1},
+	}
+	for _, tc := range tests {
+		refreshes, logins = 0, 0
+		j := &JwtAPI{ResourceAPIBaseURL: srv.URL, TokenURI: srv.URL + "/token", RefreshTokenURI: srv.URL + "/refresh"}
+		j.RefreshPolicy = tc.policy
+		j.RefreshRetries = 2
+		j.RefreshBackoff = time.Millisecond
+
+		_, err := j.Get("/protected-exp")
+		if err == nil {
+			t.Errorf("%v: Expected refresh error, Got nil", tc.policy)
+		}
+		if refreshes != tc.refreshes || logins != tc.logins {
+			t.Errorf("%v: Expected refreshes/logins: %d/%d,  Got: %d/%d", tc.policy, tc.refreshes, tc.logins, refreshes, logins)
+		}
+	}
+}
+
+func TestLazyLogin(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		logins++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(Token{AccessToken: "lazy-token"})
+	})
+	mux.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: extractToken(r)})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j := &JwtAPI{StructuredResponse: true, ResourceAPIBaseURL: srv.URL, TokenURI: srv.URL + "/token"}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := j.Get("/protected")
+			if err != nil || res.Data != "lazy-token" {
+				t.Errorf("Expected: lazy-token,  Got: %s (%v)", res.Data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if logins != 1 {
+		t.Errorf("Expected single login, Got logins: %d", logins)
+	}
+}
@@ -0,0 +1,222 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type scopesCtxKey struct{}
+
+// storeMu guards lazy creation of tokenStore for JwtAPI instances created as struct literals
+var storeMu sync.Mutex
+
+// tokenStore holds the default token of JwtAPI and the tokens requested for specific scope sets
+type tokenStore struct {
+	mu     sync.Mutex
+	token  Token
+	scoped map[string]Token
+
+	// renewMu makes sure only one request renews a stale token at a time
+	renewMu sync.Mutex
+
+	// source get tokens in place of login and refresh-token when set. stale is the token being replaced, if any.
+	source func(ctx context.Context, scopes string, stale Token) (Token, error)
+	// exchanged hold tokens received through ExchangeToken
+	exchanged map[string]Token
+	// introspected hold cached results of Introspect by hash of token
+	introspected map[string]introspectionEntry
+
+	dpop      *dpopState
+	discovery *discoveryCache
+	jwks      *jwksCache
+}
+
+// WithScopes returns a copy of ctx carrying the scopes needed by a request made through JwtAPI.Do.
+// JwtAPI will use a token granted for those scopes, requesting one if none of its tokens covers them.
+func WithScopes(ctx context.Context, scopes ...string) context.Context {
+	return context.WithValue(ctx, scopesCtxKey{}, normalizeScopes(scopes))
+}
+
+func scopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesCtxKey{}).([]string)
+	return scopes
+}
+
+// Do - call given apiurl with given method and optional JSON data, auto inject Authorization Header.
+// Scopes set on ctx by WithScopes select the token to be used. Returns RawResult{} or APIResult{} as per StructuredResponse.
+func (j *JwtAPI) Do(ctx context.Context, method, apiurl string, dataJSON []byte) (APIResult, error) {
+	var res APIResult
+	resp, err := j.makeRequest(ctx, method, apiurl, bytes.NewBuffer(dataJSON))
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return res, err
+	}
+
+	if j.StructuredResponse {
+		return getAPIResultJWT(resp)
+	}
+	return getRawResultJWT(resp)
+}
+
+func (j *JwtAPI) tokens() *tokenStore {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if j.store == nil {
+		j.store = newTokenStore()
+	}
+	return j.store
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{
+		scoped:       map[string]Token{},
+		exchanged:    map[string]Token{},
+		introspected: map[string]introspectionEntry{},
+	}
+}
+
+func (j *JwtAPI) setToken(t Token) {
+	s := j.tokens()
+	s.mu.Lock()
+	s.token = t
+	s.mu.Unlock()
+}
+
+func (s *tokenStore) get() Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// lookup returns token stored for given scope-key, empty key gives the default token
+func (s *tokenStore) lookup(key string) Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == "" {
+		return s.token
+	}
+	return s.scoped[key]
+}
+
+// tokenFor returns token to be sent for a request needing given scopes, along with its scope-key.
+// Empty scope-key means the default token is used. Token is acquired first if JwtAPI has none for the scopes
+// or default token has expired. Scopes are not used with TokenSource.
+func (j *JwtAPI) tokenFor(ctx context.Context, scopes []string) (Token, string, error) {
+	if j.TokenSource != nil && j.tokens().source == nil {
+		// source keep its own cache and notice rotated tokens, so ask it every time
+		t, err := j.TokenSource.Token(ctx)
+		if err != nil {
+			return t, "", err
+		}
+		j.setToken(t)
+		return t, "", nil
+	}
+
+	s := j.tokens()
+	if len(scopes) == 0 || coversScopes(parseScopes(j.TokenRequestData.Scopes), scopes) {
+		t := s.get()
+		if !t.usable(tokenExpirySkew) {
+			j.logDebug("tokenFor", "No valid token, acquiring new one")
+			if err := j.renewToken(ctx, "", t); err != nil {
+				return t, "", err
+			}
+			t = s.get()
+		}
+		return t, "", nil
+	}
+
+	if t, key, ok := s.coveringToken(scopes); ok {
+		return t, key, nil
+	}
+
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+	// another request may have got the token while we waited
+	if t, key, ok := s.coveringToken(scopes); ok {
+		return t, key, nil
+	}
+
+	key := strings.Join(scopes, " ")
+	j.logDebug("tokenFor", "Requesting token for scopes (%s)", key)
+	t, err := j.acquireToken(ctx, key, Token{})
+	if err != nil {
+		return t, key, err
+	}
+
+	s.mu.Lock()
+	s.scoped[key] = t
+	s.mu.Unlock()
+	return t, key, nil
+}
+
+// coveringToken find scoped token granted for superset of scopes
+func (s *tokenStore) coveringToken(scopes []string) (Token, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range s.scoped {
+		if coversScopes(strings.Fields(key), scopes) {
+			return t, key, true
+		}
+	}
+	return Token{}, "", false
+}
+
+// acquireToken get new token for given scopes through token source of JwtAPI if set, else by login.
+// Scopes are ignored by TokenSource.
+// Empty scopes means scopes of TokenRequestData.
+func (j *JwtAPI) acquireToken(ctx context.Context, scopes string, stale Token) (Token, error) {
+	if src := j.tokens().source; src != nil {
+		return src(ctx, scopes, stale)
+	}
+	if j.TokenSource != nil {
+		return j.sourceToken(ctx, stale)
+	}
+
+	treq := j.GetTokenRequestData()
+	if scopes != "" {
+		treq.Scopes = scopes
+	}
+	return j.fetchTokenByLogin(ctx, treq)
+}
+
+// parseScopes split space or comma separated scopes as used in TokenRequest.Scopes
+func parseScopes(scopes string) []string {
+	return normalizeScopes(strings.FieldsFunc(scopes, func(r rune) bool {
+		return r == ' ' || r == ','
+	}))
+}
+
+// normalizeScopes returns sorted, de-duplicated copy of scopes
+func normalizeScopes(scopes []string) []string {
+	set := map[string]bool{}
+	for _, sc := range scopes {
+		for _, f := range strings.Fields(sc) {
+			set[f] = true
+		}
+	}
+	res := make([]string, 0, len(set))
+	for sc := range set {
+		res = append(res, sc)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// coversScopes tells if granted scopes are superset of requested scopes
+func coversScopes(granted, requested []string) bool {
+	set := map[string]bool{}
+	for _, sc := range granted {
+		set[sc] = true
+	}
+	for _, sc := range requested {
+		if !set[sc] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScopedTokens(t *testing.T) {
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		var treq TokenRequest
+		json.NewDecoder(r.Body).Decode(&treq)
+		logins++
+		json.NewEncoder(w).Encode(Token{AccessToken: "tok:" + strings.Replace(treq.Scopes, " ", "+", -1)})
+	})
+	mux.HandleFunc("/scoped", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: extractToken(r)})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j := &JwtAPI{StructuredResponse: true, ResourceAPIBaseURL: srv.URL, TokenURI: srv.URL + "/token"}
+	j.TokenRequestData.Scopes = "user"
+	if _, err := j.RequestTokenByCred(); err != nil {
+		t.Fatalf("Get-Token error: %v", err)
+	}
+
+	tests := []struct {
+		scopes []string
+		exp    string
+		logins int
+	}{
+		{[]string{"orders:write", "orders:read"}, "tok:orders:read+orders:write", 2},
+		{[]string{"orders:read"}, "tok:orders:read+orders:write", 2},
+		{[]string{"billing"}, "tok:billing", 3},
+		{[]string{"user"}, "tok:user", 3},
+		{nil, "tok:user", 3},
+	}
+	for _, tc := range tests {
+		ctx := WithScopes(context.Background(), tc.scopes...)
+		res, err := j.Do(ctx, http.MethodGet, srv.URL+"/scoped", nil)
+		if err != nil {
+			t.Fatalf("Do error: %v", err)
+		}
+		if res.Data != tc.exp {
+			t.Errorf("Scopes %s, Expected: %s,  Got: %s", strings.Join(tc.scopes, ","), tc.exp, res.Data)
+		}
+		if logins != tc.logins {
+			t.Errorf("Scopes %s, Expected logins: %d,  Got: %d", strings.Join(tc.scopes, ","), tc.logins, logins)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultExecTimeout is used when ExecTokenSource.Timeout is not set
+const defaultExecTimeout = 30 * time.Second
+
+// tokenExpirySkew is time before expiry when a token is considered expired and renewed ahead of use
+const tokenExpirySkew = 10 * time.Second
+
+// TokenSource supply tokens to JwtAPI in place of login and refresh-token flow.
+// Token is called for every request, so implementations should cache the token they return.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// tokenInvalidator is implemented by token sources which cache tokens, to drop a token rejected by API
+type tokenInvalidator interface {
+	invalidate(stale Token)
+}
+
+// ExecTokenSource is TokenSource running external command, like credential helpers of corporate SSO,
+// which print token as JSON on stdout:
+//
+//	{"access_token": "...", "token_type": "Bearer", "expires_in": 3600}
+//
+// "expiry" with RFC 3339 time can be printed in place of expires_in. Token is cached until it expires.
+type ExecTokenSource struct {
+	Command string
+	Args    []string
+	// Env lists names of environment variables passed to command, no other variable is passed
+	Env []string
+	// Timeout for command to finish, default 30 seconds
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	token Token
+}
+
+// Token returns cached token, running command again when token is missing or expired
+func (e *ExecTokenSource) Token(ctx context.Context) (Token, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token.usable(tokenExpirySkew) {
+		return e.token, nil
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	env := []string{}
+	for _, name := range e.Env {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+
+	out, err := runCommand(ctx, e.Command, e.Args, env)
+	if err != nil {
+		return Token{}, fmt.Errorf("token %v", err)
+	}
+
+	var token Token
+	if err := json.Unmarshal(out, &token); err != nil {
+		return token, fmt.Errorf("failed to decode token printed by %s: %v", e.Command, err)
+	}
+	if token.AccessToken == "" {
+		return token, fmt.Errorf("token printed by %s has no access_token", e.Command)
+	}
+	if sec, ok := token.ExpiresInSeconds(); ok {
+		token.Expiry = time.Now().Add(time.Duration(sec) * time.Second)
+	} else if exp, ok := token.Extra["expiry"].(string); ok {
+		if token.Expiry, err = time.Parse(time.RFC3339, exp); err != nil {
+			return token, fmt.Errorf("invalid expiry printed by %s: %v", e.Command, err)
+		}
+	}
+
+	e.token = token
+	return token, nil
+}
+
+// String print ExecTokenSource without cached token
+func (e *ExecTokenSource) String() string {
+	return fmt.Sprintf("{Command:%s Args:%v Env:%v Timeout:%v}", e.Command, e.Args, e.Env, e.Timeout)
+}
+
+// GoString print ExecTokenSource without cached token
+func (e *ExecTokenSource) GoString() string {
+	return fmt.Sprintf("&apiclient.ExecTokenSource{Command:%q, Args:%#v, Env:%#v, Timeout:%d}", e.Command, e.Args, e.Env, e.Timeout)
+}
+
+func (e *ExecTokenSource) invalidate(stale Token) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token.AccessToken == stale.AccessToken {
+		e.token = Token{}
+	}
+}
+
+// hasTokenSource tells if tokens are obtained from a source rather than login
+func (j *JwtAPI) hasTokenSource() bool {
+	return j.TokenSource != nil || j.tokens().source != nil
+}
+
+// sourceToken get token from TokenSource, asking it to drop stale token first
+func (j *JwtAPI) sourceToken(ctx context.Context, stale Token) (Token, error) {
+	if inv, ok := j.TokenSource.(tokenInvalidator); ok && stale.AccessToken != "" {
+		inv.invalidate(stale)
+	}
+	return j.TokenSource.Token(ctx)
+}
@@ -0,0 +1,66 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// helper prints token numbered by how many times it was run, and value of allowed env variable
+	counter := filepath.Join(dir, "count")
+	script := `echo x >> "$COUNTER"; n=$(wc -l < "$COUNTER" | tr -d ' '); printf '{"access_token":"exec-%s-%s%s","expires_in":3600}' "$n" "$SSO_USER" "$SSO_SECRET"`
+	os.Setenv("SSO_USER", "alice")
+	os.Setenv("SSO_SECRET", "-leaked")
+	os.Setenv("COUNTER", counter)
+	defer os.Unsetenv("SSO_USER")
+	defer os.Unsetenv("SSO_SECRET")
+	defer os.Unsetenv("COUNTER")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
+		token := extractToken(r)
+		if token == "exec-1-alice" {
+			// first token is treated as revoked
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResult{Data: token})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	src := &ExecTokenSource{Command: "sh", Args: []string{"-c", script}, Env: []string{"SSO_USER", "COUNTER"}}
+	j := &JwtAPI{StructuredResponse: true, ResourceAPIBaseURL: srv.URL, TokenSource: src}
+	for i := 0; i < 2; i++ {
+		res, err := j.Get("/protected")
+		if err != nil {
+			t.Fatalf("APIGet error: %v", err)
+		}
+		if exp := "exec-2-alice"; res.Data != exp {
+			t.Errorf("Expected: %s,  Got: %s", exp, res.Data)
+		}
+	}
+	if out := fmt.Sprintf("%v %+v %#v", src, src, src); strings.Contains(out, "exec-2-alice") || !strings.Contains(out, "SSO_USER") {
+		t.Errorf("Expected source without cached token,  Got: %s", out)
+	}
+
+	failing := &ExecTokenSource{Command: "sh", Args: []string{"-c", "echo 'sso session expired, run sso login' >&2; exit 1"}}
+	_, err = failing.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "sso session expired") {
+		t.Errorf("Expected error with stderr,  Got: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// UnmarshalJSON decode standard token response. expires_in is accepted as number or string,
+// fields not known to Token are kept in Extra.
+func (t *Token) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	tok := Token{}
+	for k, v := range m {
+		var err error
+		switch k {
+		case "token_type":
+			err = json.Unmarshal(v, &tok.TokenType)
+		case "access_token":
+			err = json.Unmarshal(v, &tok.AccessToken)
+		case "refresh_token":
+			err = json.Unmarshal(v, &tok.RefreshToken)
+		case "scope":
+			err = json.Unmarshal(v, &tok.Scope)
+		case "id_token":
+			err = json.Unmarshal(v, &tok.IDToken)
+		case "expires_in":
+			tok.ExpiresIn, err = numberOrString(v)
+		default:
+			var x interface{}
+			err = json.Unmarshal(v, &x)
+			if tok.Extra == nil {
+				tok.Extra = map[string]interface{}{}
+			}
+			tok.Extra[k] = x
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", k, err)
+		}
+	}
+
+	*t = tok
+	return nil
+}
+
+// ExpiresInSeconds returns ExpiresIn as number of seconds, false if not set or invalid
+func (t Token) ExpiresInSeconds() (int64, bool) {
+	if t.ExpiresIn == "" {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(t.ExpiresIn, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return sec, true
+}
+
+// usable tells if token has access token which is not expiring within skew
+func (t Token) usable(skew time.Duration) bool {
+	if t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(skew).Before(t.Expiry)
+}
+
+// numberOrString decode JSON number or string (or null) to string
+func numberOrString(v json.RawMessage) (string, error) {
+	var n json.Number
+	if err := json.Unmarshal(v, &n); err == nil {
+		return n.String(), nil
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return "", fmt.Errorf("expected number or string, got %s", v)
+	}
+	return s, nil
+}
+
+// APIResultTokenMapper extract Token from APIResult envelope, where Data hold token response as JSON string.
+// It can be set as JwtAPI.TokenResponseMapper.
+func APIResultTokenMapper(body []byte) (Token, error) {
+	var token Token
+	res := APIResult{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return token, err
+	}
+	if res.ErrCode != 0 {
+		return token, fmt.Errorf("auth-server error (%d): %s", res.ErrCode, res.ErrText)
+	}
+	err := jsonStringToStruct(res.Data, &token)
+	return token, err
+}
+
+// decodeToken read token from response body through TokenResponseMapper (if set) and set its Expiry
+func (j *JwtAPI) decodeToken(body io.Reader) (Token, error) {
+	var token Token
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return token, err
+	}
+
+	if j.TokenResponseMapper != nil {
+		token, err = j.TokenResponseMapper(data)
+	} else {
+		err = json.Unmarshal(data, &token)
+	}
+	if err != nil {
+		return token, err
+	}
+
+	if sec, ok := token.ExpiresInSeconds(); ok && token.Expiry.IsZero() {
+		token.Expiry = time.Now().Add(time.Duration(sec) * time.Second)
+	}
+	return token, nil
+}
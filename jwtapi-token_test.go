@@ -0,0 +1,52 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTokenDecode(t *testing.T) {
+	tests := []struct {
+		body      string
+		expiresIn string
+		extra     string
+	}{
+		{`{"access_token":"a","expires_in":3600}`, "3600", ""},
+		{`{"access_token":"a","expires_in":"3600"}`, "3600", ""},
+		{`{"access_token":"a","expires_in":null,"tenant":"t1"}`, "", "t1"},
+		{`{"access_token":"a","scope":"user","id_token":"x.y.z"}`, "", ""},
+	}
+	for _, tc := range tests {
+		var token Token
+		if err := json.Unmarshal([]byte(tc.body), &token); err != nil {
+			t.Errorf("%s: decode error: %v", tc.body, err)
+			continue
+		}
+		if token.AccessToken != "a" || token.ExpiresIn != tc.expiresIn {
+			t.Errorf("%s: Expected: a/%s,  Got: %s/%s", tc.body, tc.expiresIn, token.AccessToken, token.ExpiresIn)
+		}
+		if tc.extra != "" && token.Extra["tenant"] != tc.extra {
+			t.Errorf("%s: Expected extra: %s,  Got: %v", tc.body, tc.extra, token.Extra)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"expires_in":true}`), &Token{}); err == nil {
+		t.Errorf("Expected error for boolean expires_in")
+	}
+}
+
+func TestAPIResultTokenMapper(t *testing.T) {
+	body := `{"HTTPStatus":200,"Data":"{\"access_token\":\"a\",\"expires_in\":60}"}`
+	token, err := APIResultTokenMapper([]byte(body))
+	if err != nil {
+		t.Fatalf("APIResultTokenMapper error: %v", err)
+	}
+	if token.AccessToken != "a" || token.ExpiresIn != "60" {
+		t.Errorf("Expected: a/60,  Got: %s/%s", token.AccessToken, token.ExpiresIn)
+	}
+
+	_, err = APIResultTokenMapper([]byte(`{"ErrCode":1,"ErrText":"invalid client"}`))
+	if err == nil {
+		t.Errorf("Expected error for ErrCode 1")
+	}
+}
@@ -2,6 +2,7 @@ package apiclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -35,7 +36,7 @@ var maxRetry = 2
 // JwtAPI provide functions to call JWT protected APIs by setting Access-Token in request Authorization header
 type JwtAPI struct {
 	TokenRequestData   TokenRequest
-	token              Token
+	store              *tokenStore
 	TokenURI           string
 	RefreshTokenURI    string
 	AllowInsecureSSL   bool
@@ -45,6 +46,65 @@ type JwtAPI struct {
 	logger             *log.Logger
 	StructuredResponse bool
 	headers            map[string]string
+
+	// DeviceAuthURI is device authorization endpoint used by RequestTokenByDeviceCode
+	DeviceAuthURI string
+	// TokenExchangeURI is endpoint used by ExchangeToken, TokenURI is used if not set
+	TokenExchangeURI string
+
+	// IssuerURL is OpenID Connect issuer. When set, endpoints not set explicitly are taken from
+	// its discovery document, which is fetched again after DiscoveryTTL (default 1 hour).
+	IssuerURL        string
+	DiscoveryTTL     time.Duration
+	RevocationURI    string
+	IntrospectionURI string
+	JWKSURI          string
+	UserInfoURI      string
+
+	// ValidateIDToken require login and device grant responses to carry id_token, which is validated before
+	// token is used. Refresh responses are validated when they carry id_token, which must keep same subject.
+	// IDTokenNonce, if set, must match nonce claim of ID token received by login.
+	ValidateIDToken bool
+	IDTokenNonce    string
+
+	// IntrospectionCacheTTL is how long results of Introspect are cached, caching is disabled when zero
+	IntrospectionCacheTTL time.Duration
+
+	// TokenSource, if set, supply tokens in place of login and refresh-token endpoints
+	TokenSource TokenSource
+
+	// TokenResponseMapper extract Token from response body of token and refresh-token endpoints.
+	// Set it for auth-servers not returning standard token response, e.g. APIResultTokenMapper.
+	TokenResponseMapper func(body []byte) (Token, error)
+
+	// UseDPoP bind tokens to a key pair generated by this client, sending signed DPoP proofs (RFC 9449)
+	// with token and API requests
+	UseDPoP bool
+
+	// RefreshPolicy decide what to do when refresh-token could not be exchanged for new token
+	RefreshPolicy RefreshPolicy
+	// RefreshRetries is how many times refresh is retried after first attempt with RefreshRetryBackoff, default 3
+	RefreshRetries int
+	// RefreshBackoff is delay before first retry with RefreshRetryBackoff, doubled on each retry. Default 500ms
+	RefreshBackoff time.Duration
+
+	// MaxRetry is how many times a request failing to connect is retried, default 2. Negative disable retries.
+	MaxRetry int
+	// RetryWait is delay before retrying a request, default 500ms
+	RetryWait time.Duration
+	// TLSConfig, if set, is used for HTTPS connections, AllowInsecureSSL still apply
+	TLSConfig *tls.Config
+	// Transport, if set, is used in place of transport built from AllowInsecureSSL and TLSConfig
+	Transport http.RoundTripper
+	// Compression, if set, compress request bodies and decompress responses
+	Compression *Compression
+	// Codecs decode responses of Request by their Content-Type, before built-in codecs
+	Codecs []Codec
+
+	// client is built once by NewJwtAPI and shared by all requests
+	client *http.Client
+	// auth, set by WithAuth, is used in place of tokens
+	auth Auth
 }
 
 // //SJwtAPI allow to maek calls to JWT protected Structured APIs by setting Access-Token in request Authorization header.
@@ -67,6 +127,12 @@ type Token struct {
 	AccessToken  string `json:"access_token"`
 	ExpiresIn    string `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// Expiry is calculated from ExpiresIn when token is received, zero if unknown
+	Expiry time.Time `json:"-"`
+	// Extra hold any other fields returned by token endpoint
+	Extra map[string]interface{} `json:"-"`
 }
 
 // TokenRequest is used to pass credential to auth-server to get new token
@@ -76,6 +142,8 @@ type TokenRequest struct {
 	Scopes       string
 	AppUserID    string
 	RefreshToken string
+	// ClientSecretProvider, if set, supply ClientSecret at the time token is requested
+	ClientSecretProvider SecretProvider `json:"-"`
 }
 
 // RefreshToken is used to get New AccessToken
@@ -83,31 +151,39 @@ type refreshToken struct {
 	RefreshToken string
 }
 
-func (j JwtAPI) GetTokenRequestData() TokenRequest {
+func (j *JwtAPI) GetTokenRequestData() TokenRequest {
 	return j.TokenRequestData
 }
-func (j JwtAPI) GetTokenURI() string {
-	return j.TokenURI
+func (j *JwtAPI) GetTokenURI() string {
+	if j.TokenURI != "" {
+		return j.TokenURI
+	}
+	return j.discovered().TokenEndpoint
 }
-func (j JwtAPI) GetRefreshTokenURI() string {
-	return j.RefreshTokenURI
+func (j *JwtAPI) GetRefreshTokenURI() string {
+	if j.RefreshTokenURI != "" {
+		return j.RefreshTokenURI
+	}
+	return j.discovered().TokenEndpoint
 }
-func (j JwtAPI) DebugEnabled() bool {
+func (j *JwtAPI) DebugEnabled() bool {
 	return j.Debug
 }
-func (j JwtAPI) GetToken() Token {
-	return j.token
+func (j *JwtAPI) GetToken() Token {
+	return j.tokens().get()
 }
-func (j JwtAPI) InsecureSSLEnabled() bool {
+func (j *JwtAPI) InsecureSSLEnabled() bool {
 	return j.AllowInsecureSSL
 }
-func (j JwtAPI) GetTimeout() time.Duration {
+func (j *JwtAPI) GetTimeout() time.Duration {
 	return j.Timeout
 }
-func (j JwtAPI) GetBaseURL() string {
+func (j *JwtAPI) GetBaseURL() string {
 	return j.ResourceAPIBaseURL
 }
 
+// SetHeaders set headers sent with every request. It is not safe while requests are running,
+// use WithHeader to get a client with its own headers.
 func (j *JwtAPI) SetHeaders(h map[string]string) {
 	j.headers = h
 }
@@ -115,23 +191,28 @@ func (j *JwtAPI) ClearHeaders() {
 	j.headers = map[string]string{}
 }
 
-func (j JwtAPI) getClient() *http.Client {
-	return getClient(j.InsecureSSLEnabled(), j.GetTimeout())
-}
-func (j JwtAPI) logMsg(methodname, format string, msg ...interface{}) {
-	if j.logger == nil {
-		j.logger = log.New(os.Stdout, "", log.LstdFlags)
+func (j *JwtAPI) getClient() *http.Client {
+	if j.client != nil {
+		return j.client
 	}
-	j.logger.Printf("INFO: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
+	return getClient(j.InsecureSSLEnabled(), j.GetTimeout(), j.TLSConfig, j.Transport)
 }
-func (j JwtAPI) logDebug(methodname, format string, msg ...interface{}) {
-	if j.logger == nil {
-		j.logger = log.New(os.Stdout, "", log.LstdFlags)
+func (j *JwtAPI) logMsg(methodname, format string, msg ...interface{}) {
+	l := j.logger
+	if l == nil {
+		l = log.New(os.Stdout, "", log.LstdFlags)
 	}
+	l.Printf("INFO: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
+}
+func (j *JwtAPI) logDebug(methodname, format string, msg ...interface{}) {
 	if !j.DebugEnabled() {
 		return
 	}
-	j.logger.Printf("DEBUG: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
+	l := j.logger
+	if l == nil {
+		l = log.New(os.Stdout, "", log.LstdFlags)
+	}
+	l.Printf("DEBUG: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
 }
 
 // func (j JwtAPI) setToken(t Token) {
@@ -190,11 +271,28 @@ func (j JwtAPI) logDebug(methodname, format string, msg ...interface{}) {
 // // 	sj.token = t
 // // }
 
-func getClient(allowInsecureSSL bool, timeout time.Duration) *http.Client {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: allowInsecureSSL},
+func getClient(allowInsecureSSL bool, timeout time.Duration, tlsConfig *tls.Config, transport http.RoundTripper) *http.Client {
+	tr := transport
+	if tr == nil {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if allowInsecureSSL {
+			cfg.InsecureSkipVerify = true
+		}
+		tr = &http.Transport{TLSClientConfig: cfg}
 	}
 
+	client := &http.Client{
+		Timeout:   clientTimeout(timeout),
+		Transport: tr,
+	}
+	return client
+}
+
+// clientTimeout returns timeout of http.Client for timeout set by client
+func clientTimeout(timeout time.Duration) time.Duration {
 	// default timeout (if not set by client)
 	timeoutInSec := 10
 
@@ -202,12 +300,7 @@ func getClient(allowInsecureSSL bool, timeout time.Duration) *http.Client {
 		// client set timeout, so use it
 		timeoutInSec = int(timeout.Seconds())
 	}
-
-	client := &http.Client{
-		Timeout:   time.Second * time.Duration(timeoutInSec),
-		Transport: tr,
-	}
-	return client
+	return time.Second * time.Duration(timeoutInSec)
 }
 
 // func logMsg(debug bool, methodname, format string, msg ...interface{}) {
@@ -217,29 +310,46 @@ func getClient(allowInsecureSSL bool, timeout time.Duration) *http.Client {
 // 	log.Printf("DEBUG: [%s] [%s]\n", methodname, fmt.Sprintf(format, msg...))
 // }
 
-func (j *JwtAPI) requestTokenByLogin() error {
+func (j *JwtAPI) requestTokenByLogin(ctx context.Context) error {
+	token, err := j.fetchTokenByLogin(ctx, j.GetTokenRequestData())
+	if err != nil {
+		return err
+	}
+
+	return j.installToken(ctx, token, j.IDTokenNonce)
+}
+
+// fetchTokenByLogin call Token endpoint with given TokenRequest and return received token without storing it
+func (j *JwtAPI) fetchTokenByLogin(ctx context.Context, treq TokenRequest) (Token, error) {
 	var token Token
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return token, err
+	}
+
+	treq, err := treq.resolve(ctx)
+	if err != nil {
+		return token, err
+	}
 
 	j.logDebug("RequestTokenByLogin", "%s", "Requesting new token through login")
 	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(j.GetTokenRequestData())
+	json.NewEncoder(b).Encode(tokenRequestJSON(treq))
 
-	r, err := http.NewRequest(http.MethodPost, j.GetTokenURI(), b)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, j.GetTokenURI(), b)
 	if err != nil {
-		return err
+		return token, err
 	}
 	r.Header.Set("Content-Type", "application/json")
 
-	client := j.getClient()
-	resp, err := client.Do(r)
+	resp, err := j.doTokenRequest(r)
 	if err != nil {
 		if resp != nil {
 			j.logDebug("RequestTokenByLogin", "failed to get new token by login (%d): %v", resp.StatusCode, err)
 			resp.Body.Close()
-			return fmt.Errorf("failed to get new token by login (%d): %v", resp.StatusCode, err)
+			return token, fmt.Errorf("failed to get new token by login (%d): %v", resp.StatusCode, err)
 		}
 		j.logMsg("RequestTokenByLogin", "failed to get new token by login: %v\n", err)
-		return fmt.Errorf("failed to get new token by login: %v", err)
+		return token, fmt.Errorf("failed to get new token by login: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -250,22 +360,33 @@ func (j *JwtAPI) requestTokenByLogin() error {
 			respStr = string(responseData)
 		}
 		j.logDebug("RequestTokenByLogin", "failed to get new token[2] by login (%d): %v\n", resp.StatusCode, err)
-		return fmt.Errorf("failed to get new token by login (%d): %s", resp.StatusCode, respStr)
+		return token, fmt.Errorf("failed to get new token by login (%d): %s", resp.StatusCode, respStr)
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&token)
+	token, err = j.decodeToken(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to extract new token: %v", err)
+		return token, fmt.Errorf("failed to extract new token: %v", err)
 	}
 
-	//j.setToken(token)
-	j.token = token
+	return token, nil
+}
+
+func (j *JwtAPI) requestTokenByRefreshToken(ctx context.Context, rtoken string) error {
+	token, err := j.fetchTokenByRefreshToken(ctx, rtoken, j.GetTokenRequestData())
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return j.installRefreshedToken(ctx, token)
 }
 
-func (j *JwtAPI) requestTokenByRefreshToken(rtoken string) error {
+// exchangeRefreshToken call RefreshToken endpoint once and return received token without storing it.
+// Returned status is 0 when endpoint could not be reached.
+func (j *JwtAPI) exchangeRefreshToken(ctx context.Context, rtoken string) (Token, int, error) {
 	var token Token
+	if err := j.ensureDiscovery(ctx); err != nil {
+		return token, 0, err
+	}
 
 	j.logDebug("RequestTokenByRefreshToken", "Debug : %t", j.DebugEnabled())
 
@@ -275,73 +396,84 @@ func (j *JwtAPI) requestTokenByRefreshToken(rtoken string) error {
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(u)
 
-	r, err := http.NewRequest(http.MethodPost, j.GetRefreshTokenURI(), b)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, j.GetRefreshTokenURI(), b)
 	if err != nil {
-		return err
+		return token, 0, err
 	}
 	r.Header.Set("Content-Type", "application/json")
 
-	client := j.getClient()
-	resp, err := client.Do(r)
+	resp, err := j.doTokenRequest(r)
 	if err != nil {
 		if resp != nil {
 			j.logDebug("RequestTokenByRefreshToken", "failed to get new token by refreshtoken (%d): %v\n", resp.StatusCode, err)
 			resp.Body.Close()
-			return fmt.Errorf("failed to get new token by refreshtoken (%d): %v", resp.StatusCode, err)
+			return token, resp.StatusCode, fmt.Errorf("failed to get new token by refreshtoken (%d): %v", resp.StatusCode, err)
 		}
 		j.logMsg("RequestTokenByRefreshToken", "failed to get new token by refreshtoken: %v\n", err)
-		return fmt.Errorf("failed to get new token by refreshtoken: %v", err)
+		return token, 0, fmt.Errorf("failed to get new token by refreshtoken: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// read response string
-
-	if resp.StatusCode != 200 {
-		// //DEBUG
-		// responseData, err := ioutil.ReadAll(r.Body)
-		// defer r.Body.Close()
-		// if err == nil {
-		// 	log.Printf("\tRefreshToke Response: %s\n", responseData)
-		// } else {
-		// 	log.Println("\tRefreshToke Response: not-readable")
-		// }
-		// //DEBUG end
-
-		//return "", fmt.Errorf("failed to get new token by refresh-token (%d)", r.StatusCode)
-
+	if resp.StatusCode != http.StatusOK {
 		// Possibly refresh-token expired or there is scope mismatch
-		//   Try to get a fresh AccessToken by login
-		return j.requestTokenByLogin()
+		responseData, _ := ioutil.ReadAll(resp.Body)
+		j.logDebug("RequestTokenByRefreshToken", "refresh-token rejected (%d)", resp.StatusCode)
+		return token, resp.StatusCode, fmt.Errorf("failed to get new token by refreshtoken (%d): %s", resp.StatusCode, responseData)
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&token)
+	token, err = j.decodeToken(resp.Body)
 	if err != nil {
 		j.logMsg("RequestTokenByRefreshToken", "Token unmarshal error: %v", err)
-		return err
+		return token, resp.StatusCode, err
 	}
 
-	//j.setToken(token)
-	j.token = token
-
 	//j.logDebug("RequestTokenByRefreshToken", "New refresh-token is (%s)", token.RefreshToken)
 
-	return nil
+	return token, resp.StatusCode, nil
+}
+
+// makeRequest makes http request for given url with given method.
+// Scopes attached to ctx through WithScopes decide which token is sent.
+func (j *JwtAPI) makeRequest(ctx context.Context, method, apiurl string, body io.Reader) (*http.Response, error) {
+	return j.makeRequestHeader(ctx, method, apiurl, body, nil)
+}
+
+// makeRequestHeader is makeRequest also setting given headers, which take precedence over
+// headers of JwtAPI and default Content-Type
+func (j *JwtAPI) makeRequestHeader(ctx context.Context, method, apiurl string, body io.Reader, header http.Header) (*http.Response, error) {
+	if b, ok := body.(*bytes.Buffer); ok {
+		j.logDebug("makeRequest", "API: %s\n\tBody: %s", apiurl, b.Bytes())
+	}
+	b, err := newRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return j.makeRequestBody(ctx, method, apiurl, b, header)
 }
 
-// makeRequest makes http request for given url with given method
-func (j *JwtAPI) makeRequest(method, apiurl string, body io.Reader) (*http.Response, error) {
+// makeRequestBody is makeRequestHeader taking body from requestBody, which is opened again
+// for each retry of request. Retry is refused with error when body is not replayable.
+func (j *JwtAPI) makeRequestBody(ctx context.Context, method, apiurl string, body requestBody, header http.Header) (*http.Response, error) {
 	retry := 0
 	connFailRetry := 0
-	//Create []byte buffer from body - so it can be passed in further retries
-	var buf []byte
-	if body != nil {
-		buf, _ = ioutil.ReadAll(body)
-	}
+	scopes := scopesFromContext(ctx)
 
 callapi:
-	j.logDebug("makeRequest", "Retry[%d], API: %s\n\tBody: %s", retry, apiurl, buf)
+	j.logDebug("makeRequest", "Retry[%d], API: %s", retry, apiurl)
 
-	r, err := http.NewRequest(method, apiurl, bytes.NewReader(buf))
+	var token Token
+	var key string
+	if j.auth == nil {
+		var err error
+		if token, key, err = j.tokenFor(ctx, scopes); err != nil {
+			return nil, err
+		}
+	}
+
+	if retry+connFailRetry > 0 && !body.replay {
+		return nil, errBodyNotReplayable
+	}
+	r, err := body.newRequest(ctx, method, apiurl)
 	if err != nil {
 		return nil, err
 	}
@@ -354,8 +486,25 @@ callapi:
 	}
 
 	//set mandatory headers
-	r.Header.Set("Authorization", "bearer "+j.GetToken().AccessToken)
-	r.Header.Set("Content-Type", "application/json")
+	if j.auth != nil {
+		if err := j.auth.Apply(r); err != nil {
+			closeBody(r)
+			return nil, err
+		}
+	} else if j.UseDPoP {
+		r.Header.Set("Authorization", "DPoP "+token.AccessToken)
+		if err := j.setDPoPProof(r, token.AccessToken); err != nil {
+			closeBody(r)
+			return nil, err
+		}
+	} else {
+		r.Header.Set("Authorization", "bearer "+token.AccessToken)
+	}
+	setDefaultContentType(r, "application/json")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	j.Compression.prepare(r)
 
 	//client := &http.Client{}
 	client := j.getClient()
@@ -363,9 +512,12 @@ callapi:
 	if err != nil {
 		errmsg := err.Error()
 		j.logMsg("makeRequest", "Api-Error: %s", errmsg)
-		if (strings.Contains(errmsg, "getsockopt: connection")) && (connFailRetry < maxRetry) {
+		if connectFailed(err) && connFailRetry < retries(j.MaxRetry) {
+			if !body.replay {
+				return nil, fmt.Errorf("%w (body not replayable)", err)
+			}
 			// couldn't connect to remote API server, connection failed, try again
-			time.Sleep(time.Millisecond * 500)
+			time.Sleep(retryWait(j.RetryWait))
 			connFailRetry++
 			if resp != nil {
 				resp.Body.Close()
@@ -374,6 +526,10 @@ callapi:
 		}
 		return nil, err
 	}
+	j.Compression.decompress(resp)
+	if j.UseDPoP && resp.StatusCode != http.StatusUnauthorized {
+		j.updateDPoPNonce(resp)
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		// //DEBUG
@@ -383,11 +539,18 @@ callapi:
 		// }
 		// //DEBUG end
 
-		if (retry < maxRetry) && (resp.StatusCode == http.StatusUnauthorized) {
+		if (retry < maxRetry) && (resp.StatusCode == http.StatusUnauthorized) && j.auth == nil {
 			j.logDebug("makerequest", "will retry API, got status: %d", resp.StatusCode)
 			resp.Body.Close()
 
-			j.requestTokenByRefreshToken(j.GetToken().RefreshToken)
+			if j.UseDPoP && j.updateDPoPNonce(resp) {
+				// server demand new nonce in DPoP proof, token is still valid
+				retry++
+				goto callapi
+			}
+			if err := j.renewToken(ctx, key, token); err != nil {
+				return nil, err
+			}
 			// again try to call same API
 			retry++
 			goto callapi
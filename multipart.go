@@ -0,0 +1,181 @@
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Multipart is multipart/form-data body with form fields and files. It is streamed
+// while request is sent, so files are never read fully in memory.
+type Multipart struct {
+	Fields url.Values
+	Files  []FilePart
+	// Progress, if set, is called with number of body bytes sent so far, starting again from 0 when
+	// request is retried. It is called from goroutine writing the body.
+	Progress func(sent int64)
+}
+
+// FilePart is file sent in Multipart
+type FilePart struct {
+	FieldName string
+	FileName  string
+	// ContentType of file, default application/octet-stream
+	ContentType string
+	// Reader is content of file. It can be read only once, so request can't be retried,
+	// e.g. after token is renewed on 401. Use Open for retriable uploads.
+	Reader io.Reader
+	// Open, if set, is used in place of Reader and called for each attempt of request
+	Open func() (io.ReadCloser, error)
+}
+
+// FileFromPath returns FilePart sending file at path, which is opened for each attempt of request
+func FileFromPath(fieldName, path, contentType string) FilePart {
+	return FilePart{
+		FieldName:   fieldName,
+		FileName:    filepath.Base(path),
+		ContentType: contentType,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+}
+
+// PostMultipart - make HTTP POST request to given api path with multipart body and return APIResult{}.
+// apipath is joined to ResourceAPIBaseURL by JoinURL.
+func (a *API) PostMultipart(ctx context.Context, apipath string, m Multipart) (APIResult, error) {
+	var res APIResult
+	apiurl, err := a.joinURL(apipath)
+	if err != nil {
+		return res, err
+	}
+
+	contentType, body := m.body()
+	return a.doBody(ctx, http.MethodPost, apiurl, contentType, body)
+}
+
+// PostMultipart - make HTTP POST request to given api path with multipart body, auto inject Authorization Header
+// and return APIResult{}. Request is retried after renewing token on 401 when all files have Open set.
+// apipath is joined to ResourceAPIBaseURL by JoinURL.
+func (j *JwtAPI) PostMultipart(ctx context.Context, apipath string, m Multipart) (APIResult, error) {
+	var res APIResult
+	apiurl, err := j.joinURL(apipath)
+	if err != nil {
+		return res, err
+	}
+
+	contentType, body := m.body()
+	return j.doBody(ctx, http.MethodPost, apiurl, contentType, body)
+}
+
+// body returns content-type of m and body opened for each attempt of request, which is
+// replayable when all files have Open. Body is written to a pipe by a goroutine, which ends
+// when body is read fully or closed.
+func (m Multipart) body() (string, requestBody) {
+	boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+
+	replay := true
+	for _, f := range m.Files {
+		if f.Open == nil {
+			replay = false
+		}
+	}
+	open := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(m.write(pw, boundary))
+		}()
+		return pr, nil
+	}
+	return "multipart/form-data; boundary=" + boundary, requestBody{open: open, size: -1, replay: replay}
+}
+
+// write write multipart body to w
+func (m Multipart) write(w io.Writer, boundary string) error {
+	if m.Progress != nil {
+		w = &progressWriter{w: w, progress: m.Progress}
+	}
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m.Fields))
+	for k := range m.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range m.Fields[k] {
+			if err := mw.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range m.Files {
+		if err := f.write(mw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (f FilePart) write(mw *multipart.Writer) error {
+	content := f.Reader
+	if f.Open != nil {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open file %s: %v", f.FileName, err)
+		}
+		defer rc.Close()
+		content = rc
+	}
+	if content == nil {
+		return fmt.Errorf("file %s has neither Reader nor Open", f.FileName)
+	}
+
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(f.FieldName), escapeQuotes(f.FileName)))
+	h.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, content)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escape name for quoted parameter of Content-Disposition, as done by mime/multipart
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// progressWriter report number of bytes written through it
+type progressWriter struct {
+	w        io.Writer
+	sent     int64
+	progress func(sent int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.sent += int64(n)
+	p.progress(p.sent)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPostMultipart(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: "upload-" + string('0'+n)})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if extractToken(r) == "upload-1" {
+			// reject first token after reading part of body
+			io.CopyN(ioutil.Discard, r.Body, 10)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f, fh, err := r.FormFile("doc")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := ioutil.ReadAll(f)
+		w.Write([]byte(r.FormValue("title") + "|" + fh.Filename + "|" + fh.Header.Get("Content-Type") + "|" + string(content)))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token")
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	ctx := context.Background()
+
+	data := strings.Repeat("report ", 1000)
+	var sent int64
+	m := Multipart{
+		Fields: url.Values{"title": {"Q3 \"final\""}},
+		Files: []FilePart{{
+			FieldName:   "doc",
+			FileName:    "q3.txt",
+			ContentType: "text/plain",
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader(data)), nil
+			},
+		}},
+		Progress: func(n int64) { atomic.StoreInt64(&sent, n) },
+	}
+	res, err := j.PostMultipart(ctx, "/upload", m)
+	if err != nil {
+		t.Fatalf("PostMultipart error: %v", err)
+	}
+	if exp := "Q3 \"final\"|q3.txt|text/plain|" + data; res.Data != exp {
+		t.Errorf("Expected upload to be retried after 401,  Got: %.60s", res.Data)
+	}
+	if atomic.LoadInt64(&sent) <= int64(len(data)) {
+		t.Errorf("Expected progress beyond %d bytes,  Got: %d", len(data), sent)
+	}
+
+	// reader can't be sent again after 401
+	atomic.StoreInt32(&logins, 0)
+	j2, _ := NewJwtAPI(srv.URL, srv.URL+"/token")
+	m.Files[0].Open = nil
+	m.Files[0].Reader = bytes.NewBufferString(data)
+	if _, err := j2.PostMultipart(ctx, "/upload", m); err == nil {
+		t.Errorf("Expected error retrying upload from Reader")
+	}
+
+	a, err := NewAPI(srv.URL)
+	if err != nil {
+		t.Fatalf("NewAPI error: %v", err)
+	}
+	m.Files[0].Reader = strings.NewReader("plain")
+	res, err = a.PostMultipart(ctx, "/upload", m)
+	if err != nil || res.Data != "Q3 \"final\"|q3.txt|text/plain|plain" {
+		t.Errorf("Expected API upload,  Got: %s (%v)", res.Data, err)
+	}
+}
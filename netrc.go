@@ -0,0 +1,231 @@
+package apiclient
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netrcMachine is credentials for one machine of .netrc, name is empty for default entry
+type netrcMachine struct {
+	name     string
+	login    string
+	password string
+	account  string
+}
+
+// netrcFile is parsed .netrc, reused until modification time or size of file change
+type netrcFile struct {
+	modTime  time.Time
+	size     int64
+	machines []netrcMachine
+}
+
+// netrcCache hold parsed .netrc files by path
+var netrcCache = struct {
+	sync.Mutex
+	files map[string]netrcFile
+}{files: map[string]netrcFile{}}
+
+// netrcPath returns .netrc file to use, NetrcPath if set, else NETRC environment variable, else ~/.netrc
+func (a *API) netrcPath() (string, error) {
+	if a.NetrcPath != "" {
+		return a.NetrcPath, nil
+	}
+	if p := os.Getenv("NETRC"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find .netrc: %v", err)
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc"), nil
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// setNetrcAuth set basic-auth credentials of request host found in .netrc to r.
+// Nothing is set when file has neither matching machine nor default entry, or when
+// default .netrc does not exist. Missing file set by NetrcPath is an error.
+func (a *API) setNetrcAuth(r *http.Request) error {
+	path, err := a.netrcPath()
+	if err != nil {
+		return err
+	}
+	machines, err := readNetrc(path)
+	if err != nil {
+		if a.NetrcPath == "" && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if m, ok := lookupNetrc(machines, r.URL.Hostname()); ok {
+		r.SetBasicAuth(m.login, m.password)
+	}
+	return nil
+}
+
+// readNetrc parse .netrc file at path, refusing files readable or writable by group or others.
+// Parsed file is cached, and read again when its modification time or size change.
+func readNetrc(path string) ([]netrcMachine, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc: %w", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("netrc %s has insecure permissions %v, it must be accessible only by owner", path, fi.Mode().Perm())
+	}
+
+	netrcCache.Lock()
+	defer netrcCache.Unlock()
+	if f, ok := netrcCache.files[path]; ok && f.modTime.Equal(fi.ModTime()) && f.size == fi.Size() {
+		return f.machines, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc: %v", err)
+	}
+	machines, err := parseNetrc(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid netrc %s: %v", path, err)
+	}
+	netrcCache.files[path] = netrcFile{modTime: fi.ModTime(), size: fi.Size(), machines: machines}
+	return machines, nil
+}
+
+// lookupNetrc returns first machine named host, or default entry when there is none
+func lookupNetrc(machines []netrcMachine, host string) (netrcMachine, bool) {
+	for _, m := range machines {
+		if m.name != "" && strings.EqualFold(m.name, host) {
+			return m, true
+		}
+	}
+	for _, m := range machines {
+		if m.name == "" {
+			return m, true
+		}
+	}
+	return netrcMachine{}, false
+}
+
+// parseNetrc parse content of .netrc. Tokens are separated by whitespace, including newlines, and may be
+// double-quoted. Lines starting with # are comments and macdef bodies, running up to next empty line, are skipped.
+// Entries after default are ignored, as default must be the last entry.
+func parseNetrc(data string) ([]netrcMachine, error) {
+	type token struct {
+		text string
+		line int
+	}
+	var tokens []token
+	inMacro := false
+	for n, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		words, err := netrcTokens(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		for _, w := range words {
+			if w == "macdef" {
+				// macro name is rest of line, its body follow on next lines
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, token{w, n + 1})
+		}
+	}
+
+	var machines []netrcMachine
+	var cur *netrcMachine
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.text {
+		case "default":
+			machines = append(machines, netrcMachine{})
+			cur = &machines[len(machines)-1]
+			continue
+		case "machine":
+			if cur != nil && cur.name == "" {
+				return machines, nil
+			}
+			machines = append(machines, netrcMachine{})
+			cur = &machines[len(machines)-1]
+		case "login", "password", "account":
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: %s without machine", tok.line, tok.text)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown token %q", tok.line, tok.text)
+		}
+
+		if i+1 >= len(tokens) {
+			return nil, fmt.Errorf("line %d: missing value for %s", tok.line, tok.text)
+		}
+		i++
+		switch tok.text {
+		case "machine":
+			cur.name = tokens[i].text
+		case "login":
+			cur.login = tokens[i].text
+		case "password":
+			cur.password = tokens[i].text
+		case "account":
+			cur.account = tokens[i].text
+		}
+	}
+	return machines, nil
+}
+
+// netrcTokens split line into whitespace separated tokens, a double-quoted token may have spaces
+// and backslash escapes
+func netrcTokens(line string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		c := line[i]
+		if c == ' ' || c == '\t' {
+			i++
+			continue
+		}
+
+		var tok strings.Builder
+		if c == '"' {
+			i++
+			closed := false
+			for ; i < len(line); i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				} else if line[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				tok.WriteByte(line[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted token")
+			}
+		} else {
+			for ; i < len(line) && line[i] != ' ' && line[i] != '\t'; i++ {
+				tok.WriteByte(line[i])
+			}
+		}
+		tokens = append(tokens, tok.String())
+	}
+	return tokens, nil
+}
@@ -0,0 +1,108 @@
+package apiclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := `# ops credentials
+machine api.example.com login alice password "s3cr3t pa\"ss"
+macdef init
+machine evil.example.com login mallory password x
+
+machine
+  other.example.com
+  login bob
+  password hunter2 account acct
+default login anon password guest
+machine late.example.com login late password late
+`
+	machines, err := parseNetrc(data)
+	if err != nil {
+		t.Fatalf("parseNetrc error: %v", err)
+	}
+
+	tests := []struct {
+		host     string
+		login    string
+		password string
+	}{
+		{"api.example.com", "alice", `s3cr3t pa"ss`},
+		{"OTHER.example.com", "bob", "hunter2"},
+		// macro body and entries after default are not machines
+		{"evil.example.com", "anon", "guest"},
+		{"late.example.com", "anon", "guest"},
+	}
+	for _, tc := range tests {
+		m, ok := lookupNetrc(machines, tc.host)
+		if !ok || m.login != tc.login || m.password != tc.password {
+			t.Errorf("%s: Expected: %s/%s,  Got: %s/%s", tc.host, tc.login, tc.password, m.login, m.password)
+		}
+	}
+
+	for _, bad := range []string{"machine", "login alice", "machine x user alice", `machine x password "open`} {
+		if _, err := parseNetrc(bad); err == nil {
+			t.Errorf("%q: Expected error", bad)
+		}
+	}
+}
+
+func TestNetrcBasicAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pwd, _ := r.BasicAuth()
+		w.Write([]byte(user + ":" + pwd))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(dir, "netrc")
+	ioutil.WriteFile(path, []byte("machine 127.0.0.1 login ops password opspwd\n"), 0600)
+
+	if prev, ok := os.LookupEnv("NETRC"); ok {
+		defer os.Setenv("NETRC", prev)
+	} else {
+		defer os.Unsetenv("NETRC")
+	}
+	os.Setenv("NETRC", path)
+
+	a := &API{ResourceAPIBaseURL: srv.URL, UseNetrc: true}
+	res, err := a.Get("/")
+	if err != nil {
+		t.Fatalf("APIGet error: %v", err)
+	}
+	if exp := "ops:opspwd"; res.Data != exp {
+		t.Errorf("Expected: %s,  Got: %s", exp, res.Data)
+	}
+
+	// changed file is read again
+	ioutil.WriteFile(path, []byte("machine 127.0.0.1 login rotated password newpwd\n"), 0600)
+	if res, err := a.Get("/"); err != nil || res.Data != "rotated:newpwd" {
+		t.Errorf("Expected: rotated:newpwd,  Got: %s (%v)", res.Data, err)
+	}
+
+	os.Chmod(path, 0644)
+	if _, err := a.Get("/"); err == nil {
+		t.Errorf("Expected error for world readable netrc")
+	}
+
+	// missing default netrc means no credentials, missing NetrcPath is an error
+	missing := filepath.Join(dir, "missing")
+	os.Setenv("NETRC", missing)
+	if res, err := a.Get("/"); err != nil || res.Data != ":" {
+		t.Errorf("Expected no credentials without netrc,  Got: %s (%v)", res.Data, err)
+	}
+	a.NetrcPath = missing
+	if _, err := a.Get("/"); err == nil {
+		t.Errorf("Expected error for missing NetrcPath")
+	}
+}
@@ -0,0 +1,438 @@
+package apiclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultRetryWait is delay before retrying a request when RetryWait is not set
+const defaultRetryWait = 500 * time.Millisecond
+
+// ConfigError is returned by constructors when a setting is invalid
+type ConfigError struct {
+	// Field is name of API, JwtAPI or Config field having invalid value
+	Field string
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Msg)
+}
+
+func configErr(field, format string, args ...interface{}) error {
+	return &ConfigError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Option configure API or JwtAPI created by NewAPI or NewJwtAPI
+type Option func(s *settings) error
+
+// settings point to fields shared by API and JwtAPI, along with client being configured,
+// so an Option can be applied to either of them
+type settings struct {
+	timeout    *time.Duration
+	insecure   *bool
+	tlsConfig  **tls.Config
+	transport  *http.RoundTripper
+	logger     **log.Logger
+	debug      *bool
+	structured *bool
+	maxRetry   *int
+	retryWait  *time.Duration
+	compress   **Compression
+	codecs     *[]Codec
+
+	// only one of api and jwt is set
+	api *API
+	jwt *JwtAPI
+}
+
+// WithTimeout set timeout of requests, default is 10 seconds
+func WithTimeout(d time.Duration) Option {
+	return func(s *settings) error {
+		if d < 0 {
+			return configErr("Timeout", "negative duration %v", d)
+		}
+		*s.timeout = d
+		return nil
+	}
+}
+
+// WithInsecureSSL skip verification of server certificates
+func WithInsecureSSL() Option {
+	return func(s *settings) error {
+		*s.insecure = true
+		return nil
+	}
+}
+
+// WithTLSConfig use cfg for HTTPS connections, e.g. to set root CAs or client certificates
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(s *settings) error {
+		if cfg == nil {
+			return configErr("TLSConfig", "nil tls.Config")
+		}
+		*s.tlsConfig = cfg
+		return nil
+	}
+}
+
+// WithTransport send requests through rt, it can't be combined with WithTLSConfig and WithInsecureSSL
+func WithTransport(rt http.RoundTripper) Option {
+	return func(s *settings) error {
+		if rt == nil {
+			return configErr("Transport", "nil http.RoundTripper")
+		}
+		*s.transport = rt
+		return nil
+	}
+}
+
+// WithLogger write logs to l
+func WithLogger(l *log.Logger) Option {
+	return func(s *settings) error {
+		if l == nil {
+			return configErr("logger", "nil log.Logger")
+		}
+		*s.logger = l
+		return nil
+	}
+}
+
+// WithDebug enable debug logs
+func WithDebug() Option {
+	return func(s *settings) error {
+		*s.debug = true
+		return nil
+	}
+}
+
+// WithStructuredResponse decode responses as APIResult
+func WithStructuredResponse() Option {
+	return func(s *settings) error {
+		*s.structured = true
+		return nil
+	}
+}
+
+// WithRetry retry requests failing to connect up to max times, waiting wait before each retry.
+// Zero max disable retries.
+func WithRetry(max int, wait time.Duration) Option {
+	return func(s *settings) error {
+		if max < 0 {
+			return configErr("MaxRetry", "negative retry count %d", max)
+		}
+		if wait < 0 {
+			return configErr("RetryWait", "negative duration %v", wait)
+		}
+		*s.maxRetry = max
+		if max == 0 {
+			*s.maxRetry = -1
+		}
+		*s.retryWait = wait
+		return nil
+	}
+}
+
+// WithCompression compress request bodies and decompress responses as per c
+func WithCompression(c Compression) Option {
+	return func(s *settings) error {
+		if err := c.validate("Compression"); err != nil {
+			return err
+		}
+		*s.compress = &c
+		return nil
+	}
+}
+
+// WithCodecs add codecs used to decode responses of Request by their Content-Type
+func WithCodecs(codecs ...Codec) Option {
+	return func(s *settings) error {
+		for _, c := range codecs {
+			if c == nil {
+				return configErr("Codecs", "nil Codec")
+			}
+			if mediaType(c.ContentType()) == "" {
+				return configErr("Codecs", "invalid content-type %q", c.ContentType())
+			}
+		}
+		*s.codecs = append(*s.codecs, codecs...)
+		return nil
+	}
+}
+
+// WithBasicAuth send basic-auth credentials with requests of API
+func WithBasicAuth(user, password string) Option {
+	return func(s *settings) error {
+		if s.api == nil {
+			return configErr("BasicAuthUser", "WithBasicAuth can be used only with API")
+		}
+		s.api.UseBasicAuth = true
+		s.api.BasicAuthUser = user
+		s.api.BasicAuthPwd = password
+		return nil
+	}
+}
+
+// WithBasicAuthProvider send basic-auth credentials with requests of API, taking password from p
+func WithBasicAuthProvider(user string, p SecretProvider) Option {
+	return func(s *settings) error {
+		if s.api == nil {
+			return configErr("BasicAuthPwdProvider", "WithBasicAuthProvider can be used only with API")
+		}
+		if p == nil {
+			return configErr("BasicAuthPwdProvider", "nil SecretProvider")
+		}
+		s.api.UseBasicAuth = true
+		s.api.BasicAuthUser = user
+		s.api.BasicAuthPwdProvider = p
+		return nil
+	}
+}
+
+// WithNetrc send basic-auth credentials found in .netrc at path with requests of API.
+// Empty path means NETRC environment variable or ~/.netrc.
+func WithNetrc(path string) Option {
+	return func(s *settings) error {
+		if s.api == nil {
+			return configErr("UseNetrc", "WithNetrc can be used only with API")
+		}
+		s.api.UseNetrc = true
+		s.api.NetrcPath = path
+		return nil
+	}
+}
+
+// WithTokenRequest set credentials used by JwtAPI to login at token endpoint
+func WithTokenRequest(treq TokenRequest) Option {
+	return func(s *settings) error {
+		if s.jwt == nil {
+			return configErr("TokenRequestData", "WithTokenRequest can be used only with JwtAPI")
+		}
+		s.jwt.TokenRequestData = treq
+		return nil
+	}
+}
+
+// WithRefreshTokenURI set refresh-token endpoint of JwtAPI, token endpoint is used if not set
+func WithRefreshTokenURI(uri string) Option {
+	return func(s *settings) error {
+		if s.jwt == nil {
+			return configErr("RefreshTokenURI", "WithRefreshTokenURI can be used only with JwtAPI")
+		}
+		s.jwt.RefreshTokenURI = uri
+		return nil
+	}
+}
+
+// WithIssuer take endpoints of JwtAPI from discovery document of OpenID Connect issuer
+func WithIssuer(issuerURL string) Option {
+	return func(s *settings) error {
+		if s.jwt == nil {
+			return configErr("IssuerURL", "WithIssuer can be used only with JwtAPI")
+		}
+		s.jwt.IssuerURL = issuerURL
+		return nil
+	}
+}
+
+// WithTokenSource get tokens of JwtAPI from ts in place of token endpoint
+func WithTokenSource(ts TokenSource) Option {
+	return func(s *settings) error {
+		if s.jwt == nil {
+			return configErr("TokenSource", "WithTokenSource can be used only with JwtAPI")
+		}
+		if ts == nil {
+			return configErr("TokenSource", "nil TokenSource")
+		}
+		s.jwt.TokenSource = ts
+		return nil
+	}
+}
+
+// WithDPoP bind tokens of JwtAPI to a key pair with DPoP proofs
+func WithDPoP() Option {
+	return func(s *settings) error {
+		if s.jwt == nil {
+			return configErr("UseDPoP", "WithDPoP can be used only with JwtAPI")
+		}
+		s.jwt.UseDPoP = true
+		return nil
+	}
+}
+
+// NewAPI returns API for given base URL configured by opts. All settings are validated,
+// and returned API share one http.Client and is safe for concurrent use as long as
+// its fields and headers are not changed.
+func NewAPI(baseURL string, opts ...Option) (*API, error) {
+	a := &API{ResourceAPIBaseURL: baseURL}
+	s := &settings{
+		timeout: &a.Timeout, insecure: &a.AllowInsecureSSL, tlsConfig: &a.TLSConfig, transport: &a.Transport,
+		logger: &a.logger, debug: &a.Debug, structured: &a.StructuredResponse,
+		maxRetry: &a.MaxRetry, retryWait: &a.RetryWait, compress: &a.Compression, codecs: &a.Codecs, api: a,
+	}
+	if err := s.apply(opts); err != nil {
+		return nil, err
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	a.client = getClient(a.AllowInsecureSSL, a.Timeout, a.TLSConfig, a.Transport)
+	return a, nil
+}
+
+// NewJwtAPI returns JwtAPI for given base URL getting tokens from tokenURI, configured by opts.
+// tokenURI can be empty when WithTokenSource or WithIssuer is used. All settings are validated,
+// and returned JwtAPI share one http.Client and is safe for concurrent use as long as
+// its fields and headers are not changed.
+func NewJwtAPI(baseURL, tokenURI string, opts ...Option) (*JwtAPI, error) {
+	j := &JwtAPI{ResourceAPIBaseURL: baseURL, TokenURI: tokenURI, store: newTokenStore()}
+	s := &settings{
+		timeout: &j.Timeout, insecure: &j.AllowInsecureSSL, tlsConfig: &j.TLSConfig, transport: &j.Transport,
+		logger: &j.logger, debug: &j.Debug, structured: &j.StructuredResponse,
+		maxRetry: &j.MaxRetry, retryWait: &j.RetryWait, compress: &j.Compression, codecs: &j.Codecs, jwt: j,
+	}
+	if err := s.apply(opts); err != nil {
+		return nil, err
+	}
+	if err := j.validate(); err != nil {
+		return nil, err
+	}
+	j.client = getClient(j.AllowInsecureSSL, j.Timeout, j.TLSConfig, j.Transport)
+	return j, nil
+}
+
+func (s *settings) apply(opts []Option) error {
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(s); err != nil {
+			return err
+		}
+	}
+	if *s.transport != nil && (*s.tlsConfig != nil || *s.insecure) {
+		return configErr("Transport", "custom transport can't be combined with TLS settings, configure TLS in the transport")
+	}
+	return nil
+}
+
+// validate check settings of API
+func (a *API) validate() error {
+	if err := validateURL("ResourceAPIBaseURL", a.ResourceAPIBaseURL); err != nil {
+		return err
+	}
+	if err := validateCommon(a.Timeout, a.RetryWait, a.Compression); err != nil {
+		return err
+	}
+	if a.UseBasicAuth && a.BasicAuthUser == "" {
+		return configErr("BasicAuthUser", "basic-auth is enabled but user is empty")
+	}
+	if a.UseBasicAuth && a.UseNetrc {
+		return configErr("UseNetrc", "basic-auth credentials are already set")
+	}
+	return nil
+}
+
+// validate check settings of JwtAPI
+func (j *JwtAPI) validate() error {
+	if err := validateURL("ResourceAPIBaseURL", j.ResourceAPIBaseURL); err != nil {
+		return err
+	}
+	if err := validateCommon(j.Timeout, j.RetryWait, j.Compression); err != nil {
+		return err
+	}
+	if j.TokenURI == "" && j.TokenSource == nil && j.IssuerURL == "" {
+		return configErr("TokenURI", "token endpoint is empty, set it or use a TokenSource or issuer")
+	}
+	uris := []struct{ field, uri string }{
+		{"TokenURI", j.TokenURI},
+		{"RefreshTokenURI", j.RefreshTokenURI},
+		{"IssuerURL", j.IssuerURL},
+		{"DeviceAuthURI", j.DeviceAuthURI},
+		{"TokenExchangeURI", j.TokenExchangeURI},
+		{"RevocationURI", j.RevocationURI},
+		{"IntrospectionURI", j.IntrospectionURI},
+		{"JWKSURI", j.JWKSURI},
+		{"UserInfoURI", j.UserInfoURI},
+	}
+	for _, u := range uris {
+		if u.uri == "" {
+			continue
+		}
+		if err := validateURL(u.field, u.uri); err != nil {
+			return err
+		}
+	}
+	if j.RefreshRetries < 0 {
+		return configErr("RefreshRetries", "negative retry count %d", j.RefreshRetries)
+	}
+	if j.RefreshBackoff < 0 {
+		return configErr("RefreshBackoff", "negative duration %v", j.RefreshBackoff)
+	}
+	if j.DiscoveryTTL < 0 {
+		return configErr("DiscoveryTTL", "negative duration %v", j.DiscoveryTTL)
+	}
+	return nil
+}
+
+func validateCommon(timeout, retryWait time.Duration, compress *Compression) error {
+	if timeout < 0 {
+		return configErr("Timeout", "negative duration %v", timeout)
+	}
+	if retryWait < 0 {
+		return configErr("RetryWait", "negative duration %v", retryWait)
+	}
+	return compress.validate("Compression")
+}
+
+// validateURL check that rawurl is absolute http or https URL
+func validateURL(field, rawurl string) error {
+	if rawurl == "" {
+		return configErr(field, "URL is empty")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return configErr(field, "%v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return configErr(field, "URL %q must start with http:// or https://", rawurl)
+	}
+	if u.Host == "" {
+		return configErr(field, "URL %q has no host", rawurl)
+	}
+	if u.Fragment != "" {
+		return configErr(field, "URL %q must not have a fragment", rawurl)
+	}
+	return nil
+}
+
+// connectFailed tells if err is failure to connect to server, so request was not sent and can be retried
+func connectFailed(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// retries returns max retries for MaxRetry setting
+func retries(max int) int {
+	if max == 0 {
+		return maxRetry
+	}
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// retryWait returns delay before retry for RetryWait setting
+func retryWait(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultRetryWait
+	}
+	return d
+}
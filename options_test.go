@@ -0,0 +1,101 @@
+package apiclient
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewClientValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		jwt   bool
+		base  string
+		token string
+		opts  []Option
+		field string
+	}{
+		{"no scheme", false, "api.example.com/v1", "", nil, "ResourceAPIBaseURL"},
+		{"no host", false, "https://", "", nil, "ResourceAPIBaseURL"},
+		{"basic-auth without user", false, "https://api.example.com", "", []Option{WithBasicAuth("", "pwd")}, "BasicAuthUser"},
+		{"negative timeout", false, "https://api.example.com", "", []Option{WithTimeout(-time.Second)}, "Timeout"},
+		{"transport with tls", false, "https://api.example.com", "", []Option{WithTransport(http.DefaultTransport), WithInsecureSSL()}, "Transport"},
+		{"jwt option on api", false, "https://api.example.com", "", []Option{WithDPoP()}, "UseDPoP"},
+		{"empty token uri", true, "https://api.example.com", "", nil, "TokenURI"},
+		{"bad token uri", true, "https://api.example.com", "auth/token", nil, "TokenURI"},
+		{"bad refresh uri", true, "https://api.example.com", "https://auth/token", []Option{WithRefreshTokenURI("ftp://auth/refresh")}, "RefreshTokenURI"},
+		{"api option on jwt", true, "https://api.example.com", "https://auth/token", []Option{WithNetrc("")}, "UseNetrc"},
+		{"negative retry", true, "https://api.example.com", "https://auth/token", []Option{WithRetry(-1, 0)}, "MaxRetry"},
+	}
+	for _, tc := range tests {
+		var err error
+		if tc.jwt {
+			_, err = NewJwtAPI(tc.base, tc.token, tc.opts...)
+		} else {
+			_, err = NewAPI(tc.base, tc.opts...)
+		}
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) || cerr.Field != tc.field {
+			t.Errorf("%s: Expected error for %s,  Got: %v", tc.name, tc.field, err)
+		}
+	}
+
+	if _, err := NewJwtAPI("https://api.example.com", "", WithTokenSource(&FileTokenSource{Path: "token"})); err != nil {
+		t.Errorf("Expected empty token uri allowed with TokenSource,  Got: %v", err)
+	}
+	if _, err := NewAPI("https://api.example.com", WithTLSConfig(&tls.Config{}), WithRetry(0, 0)); err != nil {
+		t.Errorf("Expected valid API,  Got: %v", err)
+	}
+}
+
+type countingTransport struct {
+	calls int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewJwtAPIConcurrent(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		json.NewEncoder(w).Encode(Token{AccessToken: "concurrent", ExpiresIn: "3600"})
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(APIResult{Data: extractToken(r)})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tr := &countingTransport{}
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token", WithTransport(tr), WithStructuredResponse(), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := j.Get("/data")
+			if err != nil || res.Data != "concurrent" {
+				t.Errorf("Expected: concurrent,  Got: %s (%v)", res.Data, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if logins != 1 || tr.calls != 11 {
+		t.Errorf("Expected 1 login and 11 calls through transport,  Got: %d logins, %d calls", logins, tr.calls)
+	}
+}
@@ -0,0 +1,452 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Request is built by R of API or JwtAPI to make one call with its own headers, query,
+// path parameters and body. It is sent by Get, Post, Put, Patch or Delete through
+// same auth and retry handling as other methods of the client.
+type Request struct {
+	api *API
+	jwt *JwtAPI
+
+	header     http.Header
+	query      url.Values
+	pathParams map[string]string
+
+	body        func() (io.Reader, error)
+	contentType string
+
+	result   interface{}
+	errValue interface{}
+	// codec, if set, decode response in place of codec picked by its Content-Type
+	codec Codec
+
+	// err is first error of builder methods, returned when request is sent
+	err error
+}
+
+// Response is returned by methods sending Request
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Result is value given to SetResult, decoded from body of 2xx responses
+	Result interface{}
+	// Error is value given to SetError, decoded from body of other responses
+	Error interface{}
+}
+
+// IsError tells if response status is not 2xx
+func (r *Response) IsError() bool {
+	return r.StatusCode < 200 || r.StatusCode > 299
+}
+
+// String returns body of response
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// pathParam match {name} placeholders in request path
+var pathParam = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// R returns new Request sent through a
+func (a *API) R() *Request {
+	return &Request{api: a, header: http.Header{}, query: url.Values{}, pathParams: map[string]string{}}
+}
+
+// R returns new Request sent through j, with token of j
+func (j *JwtAPI) R() *Request {
+	return &Request{jwt: j, header: http.Header{}, query: url.Values{}, pathParams: map[string]string{}}
+}
+
+// SetHeader set header k to v for this request only
+func (r *Request) SetHeader(k, v string) *Request {
+	r.header.Set(k, v)
+	return r
+}
+
+// SetQueryParam set query parameter k to v
+func (r *Request) SetQueryParam(k, v string) *Request {
+	r.query.Set(k, v)
+	return r
+}
+
+// SetQuery add all values of q to query
+func (r *Request) SetQuery(q url.Values) *Request {
+	for k, v := range q {
+		r.query[k] = append(r.query[k], v...)
+	}
+	return r
+}
+
+// SetQueryMap set query parameters from m
+func (r *Request) SetQueryMap(m map[string]string) *Request {
+	for k, v := range m {
+		r.query.Set(k, v)
+	}
+	return r
+}
+
+// SetQueryStruct set query parameters from exported fields of struct v, or pointer to it.
+// Name of parameter is taken from `url` tag of field, which can have omitempty option
+// like `url:"page,omitempty"`. Fields tagged `url:"-"` are skipped. Slices add one value per item.
+func (r *Request) SetQueryStruct(v interface{}) *Request {
+	q, err := structValues(v)
+	if err != nil {
+		r.setErr(err)
+		return r
+	}
+	return r.SetQuery(q)
+}
+
+// SetPathParam set value of {k} placeholder in path, value is escaped. Values "." and ".." are rejected.
+func (r *Request) SetPathParam(k, v string) *Request {
+	r.pathParams[k] = v
+	return r
+}
+
+// SetPathParams set values of placeholders in path
+func (r *Request) SetPathParams(m map[string]string) *Request {
+	for k, v := range m {
+		r.pathParams[k] = v
+	}
+	return r
+}
+
+// SetJSONBody send v encoded as JSON
+func (r *Request) SetJSONBody(v interface{}) *Request {
+	return r.SetCodecBody(v, JSONCodec)
+}
+
+// SetXMLBody send v encoded as XML
+func (r *Request) SetXMLBody(v interface{}) *Request {
+	return r.SetCodecBody(v, XMLCodec)
+}
+
+// SetFormBody send form as application/x-www-form-urlencoded body
+func (r *Request) SetFormBody(form url.Values) *Request {
+	return r.SetCodecBody(form, FormCodec)
+}
+
+// SetCodecBody send v encoded by c, with content-type of c
+func (r *Request) SetCodecBody(v interface{}, c Codec) *Request {
+	r.body = func() (io.Reader, error) {
+		var b bytes.Buffer
+		if err := c.Encode(&b, v); err != nil {
+			return nil, fmt.Errorf("failed to encode body: %v", err)
+		}
+		return &b, nil
+	}
+	r.contentType = c.ContentType()
+	return r
+}
+
+// SetBody send content of body with given content-type
+func (r *Request) SetBody(body io.Reader, contentType string) *Request {
+	r.body = func() (io.Reader, error) {
+		return body, nil
+	}
+	r.contentType = contentType
+	return r
+}
+
+// SetResult decode body of 2xx response into v, which must be a pointer. Body is decoded by codec
+// set by SetResponseCodec, else by codec for Content-Type of response, JSON if none match.
+// text/plain body is decoded as text only into values accepted by TextCodec, else as JSON.
+func (r *Request) SetResult(v interface{}) *Request {
+	r.result = v
+	return r
+}
+
+// SetError decode body of non-2xx response into v, which must be a pointer. See SetResult for codec.
+func (r *Request) SetError(v interface{}) *Request {
+	r.errValue = v
+	return r
+}
+
+// SetResponseCodec decode response by c, whatever its Content-Type
+func (r *Request) SetResponseCodec(c Codec) *Request {
+	r.codec = c
+	return r
+}
+
+// Get send request with GET method to given path, which is joined to base URL of client as per joinURL
+func (r *Request) Get(ctx context.Context, path string) (*Response, error) {
+	return r.Send(ctx, http.MethodGet, path)
+}
+
+// Post send request with POST method, see Get for path
+func (r *Request) Post(ctx context.Context, path string) (*Response, error) {
+	return r.Send(ctx, http.MethodPost, path)
+}
+
+// Put send request with PUT method, see Get for path
+func (r *Request) Put(ctx context.Context, path string) (*Response, error) {
+	return r.Send(ctx, http.MethodPut, path)
+}
+
+// Patch send request with PATCH method, see Get for path
+func (r *Request) Patch(ctx context.Context, path string) (*Response, error) {
+	return r.Send(ctx, http.MethodPatch, path)
+}
+
+// Delete send request with DELETE method, see Get for path
+func (r *Request) Delete(ctx context.Context, path string) (*Response, error) {
+	return r.Send(ctx, http.MethodDelete, path)
+}
+
+// Send send request with given method, see Get for path.
+// Error is returned only when request could not be made or response could not be decoded,
+// status of response is to be checked by caller.
+func (r *Request) Send(ctx context.Context, method, path string) (*Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	apiurl, err := r.url(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		if body, err = r.body(); err != nil {
+			return nil, err
+		}
+	}
+	header := http.Header{}
+	if r.contentType != "" {
+		header.Set("Content-Type", r.contentType)
+	}
+	for k, v := range r.header {
+		header[k] = v
+	}
+
+	var resp *http.Response
+	if r.jwt != nil {
+		resp, err = r.jwt.makeRequestHeader(ctx, method, apiurl, body, header)
+	} else {
+		resp, err = r.sendAPI(ctx, method, apiurl, body, header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.readResponse(resp)
+}
+
+func (r *Request) sendAPI(ctx context.Context, method, apiurl string, body io.Reader, header http.Header) (*http.Response, error) {
+	b, err := newRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := b.newRequest(ctx, method, apiurl)
+	if err != nil {
+		return nil, err
+	}
+	r.api.injectHeaders(req)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return r.api.do(req)
+}
+
+// url returns URL for path with placeholders replaced by escaped path parameters and query added.
+// Path parameters "." and ".." are rejected, as they would be resolved to other path.
+func (r *Request) url(path string) (string, error) {
+	var missing, dotted string
+	path = pathParam.ReplaceAllStringFunc(path, func(p string) string {
+		name := p[1 : len(p)-1]
+		v, ok := r.pathParams[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		if (v == "." || v == "..") && dotted == "" {
+			dotted = name
+		}
+		return url.PathEscape(v)
+	})
+	if missing != "" {
+		return "", fmt.Errorf("path parameter %s is not set", missing)
+	}
+	if dotted != "" {
+		return "", fmt.Errorf("path parameter %s can't be %q", dotted, r.pathParams[dotted])
+	}
+
+	var apiurl string
+	var err error
+	if r.jwt != nil {
+		apiurl, err = r.jwt.joinURL(path)
+	} else {
+		apiurl, err = r.api.joinURL(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(r.query) == 0 {
+		return apiurl, nil
+	}
+
+	u, err := url.Parse(apiurl)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for k, v := range r.query {
+		q[k] = append(q[k], v...)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (r *Request) readResponse(resp *http.Response) (*Response, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	dest := r.result
+	if res.IsError() {
+		dest = r.errValue
+	}
+	if dest == nil || len(bytes.TrimSpace(body)) == 0 {
+		return res, nil
+	}
+	if err := r.responseCodec(resp, dest).Decode(bytes.NewReader(body), dest); err != nil {
+		return res, fmt.Errorf("failed to decode response (%d): %v", resp.StatusCode, err)
+	}
+	if res.IsError() {
+		res.Error = dest
+	} else {
+		res.Result = dest
+	}
+	return res, nil
+}
+
+// responseCodec returns codec decoding resp into dest
+func (r *Request) responseCodec(resp *http.Response, dest interface{}) Codec {
+	if r.codec != nil {
+		return r.codec
+	}
+	var codecs []Codec
+	if r.jwt != nil {
+		codecs = r.jwt.Codecs
+	} else {
+		codecs = r.api.Codecs
+	}
+	c := codecFor(resp.Header.Get("Content-Type"), codecs)
+	if c == nil || (c == TextCodec && !isTextValue(dest)) {
+		// servers often send JSON without Content-Type, which is then sniffed as text/plain
+		return JSONCodec
+	}
+	return c
+}
+
+func (r *Request) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// structValues returns query values of exported fields of struct v as per their `url` tags
+func structValues(v interface{}) (url.Values, error) {
+	q := url.Values{}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return q, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query must be a struct, got %T", v)
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("url"); ok {
+			if tag == "-" {
+				continue
+			}
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				tag, opts = tag[:idx], tag[idx+1:]
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fv := rv.Field(i)
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if (fv.Kind() == reflect.Ptr && fv.IsNil()) || (strings.Contains(opts, "omitempty") && isZeroValue(fv)) {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := queryValue(fv.Index(j))
+				if err != nil {
+					return nil, fmt.Errorf("query field %s: %v", f.Name, err)
+				}
+				q.Add(name, s)
+			}
+			continue
+		}
+		s, err := queryValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("query field %s: %v", f.Name, err)
+		}
+		q.Set(name, s)
+	}
+	return q, nil
+}
+
+// queryValue format v as query parameter value
+func queryValue(v reflect.Value) (string, error) {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %v", v.Type())
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
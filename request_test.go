@@ -0,0 +1,131 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type orderQuery struct {
+	Status []string `url:"status"`
+	Page   int      `url:"page,omitempty"`
+	Cursor *string  `url:"cursor"`
+	Debug  bool     `url:"-"`
+	Limit  uint
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func TestRequestBuilder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Token{AccessToken: "builder", ExpiresIn: "3600"})
+	})
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/users/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Code: "not_found", Message: "no such user"})
+			return
+		}
+		r.ParseForm()
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":   r.URL.EscapedPath(),
+			"query":  r.URL.RawQuery,
+			"auth":   r.Header.Get("Authorization"),
+			"trace":  r.Header.Get("X-Trace"),
+			"type":   r.Header.Get("Content-Type"),
+			"status": r.PostForm.Get("status"),
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	j, err := NewJwtAPI(srv.URL, srv.URL+"/token")
+	if err != nil {
+		t.Fatalf("NewJwtAPI error: %v", err)
+	}
+	ctx := context.Background()
+
+	var got map[string]string
+	res, err := j.R().
+		SetHeader("X-Trace", "t1").
+		SetPathParam("id", "a/b c").
+		SetQueryStruct(orderQuery{Status: []string{"open", "paid"}, Limit: 5}).
+		SetQueryParam("sort", "desc").
+		SetFormBody(url.Values{"status": {"closed"}}).
+		SetResult(&got).
+		Post(ctx, "/users/{id}/orders")
+	if err != nil {
+		t.Fatalf("Post error: %v", err)
+	}
+	exp := map[string]string{
+		"path":   "/users/a%2Fb%20c/orders",
+		"query":  "Limit=5&sort=desc&status=open&status=paid",
+		"auth":   "bearer builder",
+		"trace":  "t1",
+		"type":   "application/x-www-form-urlencoded",
+		"status": "closed",
+	}
+	for k, v := range exp {
+		if got[k] != v {
+			t.Errorf("%s: Expected: %s,  Got: %s", k, v, got[k])
+		}
+	}
+	if res.Result != &got {
+		t.Errorf("Expected Result to be set")
+	}
+
+	var apiErr apiError
+	res, err = j.R().SetPathParam("id", "missing").SetResult(&got).SetError(&apiErr).Get(ctx, "/users/{id}")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if !res.IsError() || res.StatusCode != http.StatusNotFound || apiErr.Code != "not_found" {
+		t.Errorf("Expected not_found error,  Got: %d %+v", res.StatusCode, apiErr)
+	}
+
+	if _, err := j.R().Get(ctx, "/users/{id}"); err == nil {
+		t.Errorf("Expected error for missing path parameter")
+	}
+	for _, v := range []string{".", ".."} {
+		if _, err := j.R().SetPathParam("id", v).Post(ctx, "/users/{id}/delete"); err == nil {
+			t.Errorf("%q: Expected error for dot segment path parameter", v)
+		}
+	}
+	if _, err := j.R().SetQueryStruct("page=1").Get(ctx, "/users/1"); err == nil {
+		t.Errorf("Expected error for non-struct query")
+	}
+}
+
+func TestRequestBuilderAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]int
+		json.NewDecoder(r.Body).Decode(&body)
+		user, _, _ := r.BasicAuth()
+		json.NewEncoder(w).Encode(map[string]interface{}{"user": user, "qty": body["qty"], "item": r.URL.Query().Get("item")})
+	}))
+	defer srv.Close()
+
+	a, err := NewAPI(srv.URL, WithBasicAuth("ops", "pwd"))
+	if err != nil {
+		t.Fatalf("NewAPI error: %v", err)
+	}
+	var got struct {
+		User string
+		Qty  int
+		Item string
+	}
+	_, err = a.R().SetQueryMap(map[string]string{"item": "pen"}).SetJSONBody(map[string]int{"qty": 3}).SetResult(&got).Put(context.Background(), "/cart")
+	if err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	if got.User != "ops" || got.Qty != 3 || got.Item != "pen" {
+		t.Errorf("Expected: ops/3/pen,  Got: %+v", got)
+	}
+}
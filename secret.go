@@ -0,0 +1,296 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedText replace secret values in String, GoString and MarshalJSON output
+const redactedText = "REDACTED"
+
+// SecretProvider returns secret (password, client-secret etc.) when it is needed by a request,
+// so it need not be kept in plain struct fields
+type SecretProvider interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// StaticSecret is SecretProvider returning fixed value
+type StaticSecret string
+
+// Secret returns s
+func (s StaticSecret) Secret(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// String never print the secret
+func (s StaticSecret) String() string {
+	return redact(string(s))
+}
+
+// GoString never print the secret
+func (s StaticSecret) GoString() string {
+	return "apiclient.StaticSecret(" + redact(string(s)) + ")"
+}
+
+// EnvSecret is SecretProvider reading secret from environment variable with given name
+type EnvSecret string
+
+// Secret returns value of environment variable, error if it is not set
+func (e EnvSecret) Secret(ctx context.Context) (string, error) {
+	v, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", string(e))
+	}
+	return v, nil
+}
+
+// FileSecret is SecretProvider reading secret from file at Path. Surrounding whitespace is trimmed.
+// File is read again whenever its modification time or size change.
+type FileSecret struct {
+	Path string
+
+	mu      sync.Mutex
+	value   string
+	modTime time.Time
+	size    int64
+}
+
+// Secret returns content of file, reloading it if file has changed since last read
+func (f *FileSecret) Secret(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	if f.value != "" && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.value, nil
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	f.value = strings.TrimSpace(string(data))
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	return f.value, nil
+}
+
+// String print FileSecret without secret read from file
+func (f *FileSecret) String() string {
+	return fmt.Sprintf("{Path:%s}", f.Path)
+}
+
+// GoString print FileSecret without secret read from file
+func (f *FileSecret) GoString() string {
+	return fmt.Sprintf("&apiclient.FileSecret{Path:%q}", f.Path)
+}
+
+// ExecSecret is SecretProvider running Command with Args and using its trimmed stdout as secret.
+// Output is reused for CacheTTL when set, else command is run every time secret is needed.
+type ExecSecret struct {
+	Command  string
+	Args     []string
+	CacheTTL time.Duration
+
+	mu      sync.Mutex
+	value   string
+	fetched time.Time
+}
+
+// Secret returns output of command, error includes stderr of command when it fails
+func (e *ExecSecret) Secret(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.CacheTTL > 0 && e.value != "" && time.Since(e.fetched) < e.CacheTTL {
+		return e.value, nil
+	}
+
+	out, err := runCommand(ctx, e.Command, e.Args, nil)
+	if err != nil {
+		return "", fmt.Errorf("secret %v", err)
+	}
+
+	e.value = strings.TrimSpace(string(out))
+	e.fetched = time.Now()
+	return e.value, nil
+}
+
+// String print ExecSecret without cached output of command
+func (e *ExecSecret) String() string {
+	return fmt.Sprintf("{Command:%s Args:%v CacheTTL:%v}", e.Command, e.Args, e.CacheTTL)
+}
+
+// GoString print ExecSecret without cached output of command
+func (e *ExecSecret) GoString() string {
+	return fmt.Sprintf("&apiclient.ExecSecret{Command:%q, Args:%#v, CacheTTL:%d}", e.Command, e.Args, e.CacheTTL)
+}
+
+// runCommand run command and returns its stdout. Command inherit environment when env is nil.
+// Returned error includes stderr of failed command.
+func runCommand(ctx context.Context, command string, args []string, env []string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("command %s failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redactedText
+}
+
+//
+// Redacting String, GoString and MarshalJSON of structs holding secrets.
+// Token is only redacted when printed, its JSON is kept as sent by auth-server.
+//
+
+// tokenRequestJSON is TokenRequest as sent to auth-server, without redaction
+type tokenRequestJSON TokenRequest
+
+func (tr TokenRequest) redacted() tokenRequestJSON {
+	tr.ClientSecret = redact(tr.ClientSecret)
+	tr.RefreshToken = redact(tr.RefreshToken)
+	return tokenRequestJSON(tr)
+}
+
+// String print TokenRequest with secrets redacted
+func (tr TokenRequest) String() string {
+	return fmt.Sprintf("%+v", tr.redacted())
+}
+
+// GoString print TokenRequest with secrets redacted
+func (tr TokenRequest) GoString() string {
+	return strings.Replace(fmt.Sprintf("%#v", tr.redacted()), "tokenRequestJSON", "TokenRequest", 1)
+}
+
+// MarshalJSON encode TokenRequest with secrets redacted
+func (tr TokenRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tr.redacted())
+}
+
+// tokenExchangeRequestJSON is TokenExchangeRequest without redacting methods
+type tokenExchangeRequestJSON TokenExchangeRequest
+
+func (tr TokenExchangeRequest) redacted() tokenExchangeRequestJSON {
+	tr.SubjectToken = redact(tr.SubjectToken)
+	tr.ActorToken = redact(tr.ActorToken)
+	return tokenExchangeRequestJSON(tr)
+}
+
+// String print TokenExchangeRequest with tokens redacted
+func (tr TokenExchangeRequest) String() string {
+	return fmt.Sprintf("%+v", tr.redacted())
+}
+
+// GoString print TokenExchangeRequest with tokens redacted
+func (tr TokenExchangeRequest) GoString() string {
+	return strings.Replace(fmt.Sprintf("%#v", tr.redacted()), "tokenExchangeRequestJSON", "TokenExchangeRequest", 1)
+}
+
+// MarshalJSON encode TokenExchangeRequest with tokens redacted
+func (tr TokenExchangeRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tr.redacted())
+}
+
+// resolve returns copy of tr with ClientSecret taken from ClientSecretProvider, if set
+func (tr TokenRequest) resolve(ctx context.Context) (TokenRequest, error) {
+	if tr.ClientSecretProvider == nil {
+		return tr, nil
+	}
+	secret, err := tr.ClientSecretProvider.Secret(ctx)
+	if err != nil {
+		return tr, fmt.Errorf("failed to get client secret: %v", err)
+	}
+	tr.ClientSecret = secret
+	return tr, nil
+}
+
+// tokenJSON is Token without redacting methods
+type tokenJSON Token
+
+func (t Token) redacted() tokenJSON {
+	t.AccessToken = redact(t.AccessToken)
+	t.RefreshToken = redact(t.RefreshToken)
+	t.IDToken = redact(t.IDToken)
+	return tokenJSON(t)
+}
+
+// String print Token with secrets redacted
+func (t Token) String() string {
+	return fmt.Sprintf("%+v", t.redacted())
+}
+
+// GoString print Token with secrets redacted
+func (t Token) GoString() string {
+	return strings.Replace(fmt.Sprintf("%#v", t.redacted()), "tokenJSON", "Token", 1)
+}
+
+// apiJSON is API without redacting methods
+type apiJSON API
+
+func (a API) redacted() apiJSON {
+	a.BasicAuthPwd = redact(a.BasicAuthPwd)
+	return apiJSON(a)
+}
+
+// String print API with secrets redacted
+func (a API) String() string {
+	return fmt.Sprintf("%+v", a.redacted())
+}
+
+// GoString print API with secrets redacted
+func (a API) GoString() string {
+	return strings.Replace(fmt.Sprintf("%#v", a.redacted()), "apiJSON", "API", 1)
+}
+
+// MarshalJSON encode API with secrets redacted
+func (a API) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.redacted())
+}
+
+// configJSON is Config without redacting methods
+type configJSON Config
+
+func (c Config) redacted() configJSON {
+	c.ClientSecret = redact(c.ClientSecret)
+	c.BasicAuthPwd = redact(c.BasicAuthPwd)
+	// profiles may hold secrets too
+	c.Profiles = nil
+	return configJSON(c)
+}
+
+// String print Config with secrets redacted
+func (c Config) String() string {
+	return fmt.Sprintf("%+v", c.redacted())
+}
+
+// GoString print Config with secrets redacted
+func (c Config) GoString() string {
+	return strings.Replace(fmt.Sprintf("%#v", c.redacted()), "configJSON", "Config", 1)
+}
+
+// MarshalJSON encode Config with secrets redacted
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.redacted())
+}
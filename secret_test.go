@@ -0,0 +1,90 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretRedaction(t *testing.T) {
+	treq := TokenRequest{ClientID: "cli", ClientSecret: "s3cret-1", RefreshToken: "s3cret-2"}
+	xreq := TokenExchangeRequest{SubjectToken: "s3cret-7", ActorToken: "s3cret-8", Audience: "aud"}
+	token := Token{AccessToken: "s3cret-3", RefreshToken: "s3cret-4", IDToken: "s3cret-5"}
+	api := API{BasicAuthUser: "user", BasicAuthPwd: "s3cret-6"}
+	jwtapi := JwtAPI{TokenRequestData: treq}
+
+	ab, _ := json.Marshal(api)
+	xb, _ := json.Marshal(xreq)
+	outputs := []string{
+		fmt.Sprintf("%v %+v %#v", treq, treq, treq),
+		fmt.Sprintf("%v %+v %#v", token, token, token),
+		fmt.Sprintf("%v %+v %#v", api, api, &api),
+		fmt.Sprintf("%+v", jwtapi),
+		fmt.Sprintf("%v %+v %#v", xreq, xreq, xreq),
+		string(ab), string(xb),
+	}
+	for _, out := range outputs {
+		if strings.Contains(out, "s3cret") {
+			t.Errorf("Secret leaked in: %s", out)
+		}
+	}
+	if !strings.Contains(outputs[0], "cli") || !strings.Contains(outputs[0], redactedText) {
+		t.Errorf("Expected non-secret fields and redaction mark,  Got: %s", outputs[0])
+	}
+
+	// Token keep its secrets in JSON, to be stored or served
+	var decoded Token
+	tb, _ := json.Marshal(token)
+	if err := json.Unmarshal(tb, &decoded); err != nil || decoded.AccessToken != token.AccessToken || decoded.IDToken != token.IDToken {
+		t.Errorf("Expected Token JSON round-trip,  Got: %s (%v)", tb, err)
+	}
+}
+
+func TestFileSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secret")
+	ioutil.WriteFile(path, []byte("first\n"), 0600)
+	fs := &FileSecret{Path: path}
+	ctx := context.Background()
+	if v, err := fs.Secret(ctx); err != nil || v != "first" {
+		t.Errorf("Expected: first,  Got: %s (%v)", v, err)
+	}
+
+	ioutil.WriteFile(path, []byte("second-value\n"), 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if v, err := fs.Secret(ctx); err != nil || v != "second-value" {
+		t.Errorf("Expected reloaded: second-value,  Got: %s (%v)", v, err)
+	}
+	if out := fmt.Sprintf("%v %+v %#v", fs, fs, fs); strings.Contains(out, "second-value") || !strings.Contains(out, path) {
+		t.Errorf("Expected path without secret,  Got: %s", out)
+	}
+}
+
+func TestExecSecret(t *testing.T) {
+	ctx := context.Background()
+	es := &ExecSecret{Command: "sh", Args: []string{"-c", "echo from-exec"}}
+	if v, err := es.Secret(ctx); err != nil || v != "from-exec" {
+		t.Errorf("Expected: from-exec,  Got: %s (%v)", v, err)
+	}
+	es = &ExecSecret{Command: "printf", Args: []string{"exec-%s", "out"}}
+	es.Secret(ctx)
+	if out := fmt.Sprintf("%v %+v %#v", es, es, es); strings.Contains(out, "exec-out") || !strings.Contains(out, "printf") {
+		t.Errorf("Expected command without its output,  Got: %s", out)
+	}
+
+	es = &ExecSecret{Command: "sh", Args: []string{"-c", "echo vault sealed >&2; exit 3"}}
+	if _, err := es.Secret(ctx); err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Errorf("Expected error with stderr,  Got: %v", err)
+	}
+}